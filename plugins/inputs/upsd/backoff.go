@@ -0,0 +1,24 @@
+package upsd
+
+import (
+	"math"
+	"time"
+)
+
+// backoff returns the delay before the given retry, starting at the base
+// delay and doubling with each retry up to the maximum. No maximum is
+// applied if it is zero.
+func backoff(base, max time.Duration, retry int) time.Duration {
+	delay := base
+	for i := 0; i < retry && (max <= 0 || delay < max); i++ {
+		if delay > math.MaxInt64/2 {
+			delay = math.MaxInt64
+			break
+		}
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	return delay
+}
@@ -0,0 +1,97 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestBackoff(t *testing.T) {
+	var delays []time.Duration
+	for retry := 0; retry < 8; retry++ {
+		delays = append(delays, backoff(time.Second, 10*time.Second, retry))
+	}
+	require.Equal(t, []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		10 * time.Second,
+		10 * time.Second,
+		10 * time.Second,
+		10 * time.Second,
+	}, delays)
+
+	// Without maximum the delay keeps growing but never overflows
+	require.Equal(t, 1024*time.Second, backoff(time.Second, 0, 10))
+	require.Equal(t, time.Duration(1<<63-1), backoff(time.Second, 0, 100))
+	require.Equal(t, time.Duration(0), backoff(0, time.Minute, 5))
+}
+
+func TestUpsdRetryMaxBackoff(t *testing.T) {
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = time.Sleep }()
+
+	server := newMockServer()
+	server.responses["LIST UPS"] = "ERR DRIVER-NOT-CONNECTED\n"
+	addr := server.listen(t)
+
+	maxBackoff := 5 * time.Second
+	plugin := &Upsd{
+		Servers:      []string{addr.String()},
+		Retries:      6,
+		RetryBackoff: config.Duration(time.Second),
+		MaxBackoff:   config.Duration(maxBackoff),
+		Log:          testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+
+	require.Len(t, slept, 6)
+	for i, d := range slept {
+		require.LessOrEqual(t, d, maxBackoff, "retry %d", i)
+	}
+	require.Equal(t, []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		maxBackoff,
+		maxBackoff,
+		maxBackoff,
+	}, slept)
+}
+
+func TestUpsdRetryBackoffBudget(t *testing.T) {
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = time.Sleep }()
+
+	server := newMockServer()
+	server.responses["LIST UPS"] = "ERR DRIVER-NOT-CONNECTED\n"
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Servers:      []string{addr.String()},
+		Retries:      3,
+		RetryBudget:  config.Duration(time.Second),
+		RetryBackoff: config.Duration(30 * time.Second),
+		MaxBackoff:   config.Duration(30 * time.Second),
+		Log:          testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+
+	// The delay is cut to the remaining budget, exhausting it
+	require.Equal(t, []time.Duration{time.Second}, slept)
+}
@@ -0,0 +1,22 @@
+package upsd
+
+// Beeper states silencing the alarms
+var mutedBeeperStates = []string{"muted", "disabled"}
+
+// addBeeperChange adds the beeper_muted_changed field reporting whether the
+// beeper was muted or unmuted since the last gather. The field is omitted
+// until the beeper state of the UPS is known from a previous gather.
+func (u *Upsd) addBeeperChange(key string, variables map[string]string, fields map[string]interface{}) {
+	status, ok := variables["ups.beeper.status"]
+	if !ok {
+		return
+	}
+	muted := indexOf(status, mutedBeeperStates) >= 0
+
+	s, _ := u.state(key)
+	if s.beeperKnown {
+		fields["beeper_muted_changed"] = muted != s.beeperMuted
+	}
+	s.beeperKnown = true
+	s.beeperMuted = muted
+}
@@ -0,0 +1,53 @@
+package upsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdBeeperMutedChanged(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	sequence := []struct {
+		status   string
+		expected interface{}
+	}{
+		{status: "enabled"},
+		{status: "enabled", expected: false},
+		{status: "muted", expected: true},
+		{status: "muted", expected: false},
+		{status: "enabled", expected: true},
+		{status: "disabled", expected: true},
+		{status: "muted", expected: false},
+		{status: "enabled", expected: true},
+	}
+
+	for i, step := range sequence {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+			"ups.beeper.status": step.status,
+			"ups.status":        "OL",
+		})
+		require.NoError(t, acc.FirstError())
+
+		status, ok := acc.StringField("upsd", "beeper_status")
+		require.True(t, ok, "step %d", i)
+		require.Equal(t, step.status, status, "step %d", i)
+
+		changed, ok := acc.BoolField("upsd", "beeper_muted_changed")
+		if step.expected == nil {
+			require.False(t, ok, "step %d", i)
+			continue
+		}
+		require.True(t, ok, "step %d", i)
+		require.Equal(t, step.expected, changed, "step %d", i)
+	}
+
+	// UPSes without beeper do not report changes
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "other", map[string]string{"ups.status": "OL"})
+	require.False(t, acc.HasField("upsd", "beeper_muted_changed"))
+}
@@ -0,0 +1,86 @@
+package upsd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// cachedUps holds the last successfully collected variables of a UPS
+type cachedUps struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Variables map[string]string `json:"variables"`
+}
+
+// loadCache reads the last-known variables from the cache file. A missing
+// file results in an empty cache.
+func (u *Upsd) loadCache() error {
+	u.cache = make(map[string]map[string]cachedUps)
+
+	content, err := ioutil.ReadFile(u.CacheFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, &u.cache)
+}
+
+// updateCache replaces the cached variables of the given server and
+// persists the cache. The UPSes timed out keep their last-known variables.
+// The file is replaced atomically so that a crash never leaves a truncated
+// cache behind.
+func (u *Upsd) updateCache(ep endpoint, upsList map[string]map[string]string, timedOut []string) error {
+	if u.cache == nil {
+		u.cache = make(map[string]map[string]cachedUps)
+	}
+
+	timestamp := now()
+	entries := make(map[string]cachedUps, len(upsList))
+	for name, variables := range upsList {
+		entries[name] = cachedUps{Timestamp: timestamp, Variables: variables}
+	}
+	for _, name := range timedOut {
+		if entry, found := u.cache[ep.address()][name]; found {
+			entries[name] = entry
+		}
+	}
+	u.cache[ep.address()] = entries
+
+	content, err := json.Marshal(u.cache)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(u.CacheFile), filepath.Base(u.CacheFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), u.CacheFile)
+}
+
+// gatherCached emits the last-known variables of the UPSes of the given
+// server tagged as stale, skipping the ones exceeding the maximum age.
+func (u *Upsd) gatherCached(acc telegraf.Accumulator, ep endpoint) {
+	u.stale = true
+	defer func() { u.stale = false }()
+
+	for name, entry := range u.cache[ep.address()] {
+		if u.CacheMaxAge > 0 && now().Sub(entry.Timestamp) > time.Duration(u.CacheMaxAge) {
+			continue
+		}
+		u.gatherUps(acc, ep, name, entry.Variables)
+	}
+}
@@ -0,0 +1,205 @@
+package upsd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdCacheLastKnown(t *testing.T) {
+	current := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	server := newMockServer()
+	server.addUps("fake", map[string]string{
+		"battery.charge": "100",
+		"ups.status":     "OL",
+	})
+	addr := server.listen(t)
+
+	path := filepath.Join(t.TempDir(), "cache.json")
+	newPlugin := func() *Upsd {
+		plugin := &Upsd{
+			Server:         addr.IP.String(),
+			Port:           addr.Port,
+			CacheLastKnown: true,
+			CacheFile:      path,
+			CacheMaxAge:    config.Duration(10 * time.Minute),
+			Log:            testutil.Logger{},
+		}
+		require.NoError(t, plugin.Init())
+		return plugin
+	}
+	plugin := newPlugin()
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.True(t, acc.HasMeasurement("upsd"))
+	require.False(t, acc.HasTag("upsd", "stale"))
+
+	// The server fails, the cached values are emitted as stale
+	server.Lock()
+	server.responses["LIST UPS"] = "ERR DRIVER-NOT-CONNECTED\n"
+	server.Unlock()
+	current = current.Add(5 * time.Minute)
+
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	require.Equal(t, "true", acc.TagValue("upsd", "stale"))
+	require.Equal(t, "fake", acc.TagValue("upsd", "ups_name"))
+	charge, ok := acc.Int64Field("upsd", "battery_charge_percent")
+	require.True(t, ok)
+	require.Equal(t, int64(100), charge)
+	acc.AssertContainsFields(t, "upsd_servers", map[string]interface{}{
+		"configured":      1,
+		"reachable":       0,
+		"reachable_ratio": 0.0,
+	})
+
+	// The cache survives restarts
+	acc = testutil.Accumulator{}
+	require.NoError(t, newPlugin().Gather(&acc))
+	require.Equal(t, "true", acc.TagValue("upsd", "stale"))
+
+	// Cached values exceeding the maximum age are dropped
+	current = current.Add(6 * time.Minute)
+	acc = testutil.Accumulator{}
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	require.False(t, acc.HasMeasurement("upsd"))
+}
+
+func TestUpsdCacheLastKnownUpsTimeout(t *testing.T) {
+	current := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	server.addUps("hanging", map[string]string{"ups.status": "OB"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:         addr.IP.String(),
+		Port:           addr.Port,
+		UpsTimeout:     config.Duration(100 * time.Millisecond),
+		CacheLastKnown: true,
+		CacheFile:      filepath.Join(t.TempDir(), "cache.json"),
+		Log:            testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	cached := plugin.cache[addr.String()]["hanging"]
+
+	// The timed-out UPS keeps its last-known variables
+	server.Lock()
+	server.delays["LIST VAR hanging"] = 2 * time.Second
+	server.Unlock()
+	current = current.Add(time.Minute)
+
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.Contains(t, plugin.cache[addr.String()], "fake")
+	require.Equal(t, cached, plugin.cache[addr.String()]["hanging"])
+
+	// Both UPSes are emitted as stale once the server fails
+	server.Lock()
+	server.responses["LIST UPS"] = "ERR DRIVER-NOT-CONNECTED\n"
+	server.Unlock()
+
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	stale := make(map[string]string)
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "upsd" {
+			stale[m.Tags()["ups_name"]] = m.Tags()["stale"]
+		}
+	}
+	require.Equal(t, map[string]string{"fake": "true", "hanging": "true"}, stale)
+}
+
+func TestUpsdCacheLastKnownInvalid(t *testing.T) {
+	plugin := &Upsd{
+		Server:         defaultAddress,
+		Port:           defaultPort,
+		CacheLastKnown: true,
+		Log:            testutil.Logger{},
+	}
+	require.EqualError(t, plugin.Init(), "cache_file required for caching the last-known values")
+}
+
+func TestUpsdCacheLastKnownState(t *testing.T) {
+	current := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	server := newMockServer()
+	server.addUps("fake", map[string]string{
+		"battery.charge": "100",
+		"ups.status":     "OL",
+	})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:         addr.IP.String(),
+		Port:           addr.Port,
+		UpsTimeout:     config.Duration(time.Second),
+		EmitEvents:     true,
+		CacheLastKnown: true,
+		CacheFile:      filepath.Join(t.TempDir(), "cache.json"),
+		CacheMaxAge:    config.Duration(time.Hour),
+		Log:            testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	// The stale values are neither reported as reachable nor derived from
+	server.Lock()
+	server.responses["LIST UPS"] = "ERR DRIVER-NOT-CONNECTED\n"
+	server.Unlock()
+	current = current.Add(5 * time.Minute)
+
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(&acc))
+	require.Equal(t, "true", acc.TagValue("upsd", "stale"))
+	require.False(t, acc.HasField("upsd", "reachable"))
+	require.False(t, acc.HasField("upsd", "battery_charge_rate_pct_per_hour"))
+	require.False(t, acc.HasField("upsd", "data_advanced"))
+	require.False(t, acc.HasField("upsd", "status_changed_bits"))
+
+	// The fresh values are compared against the last fresh gather
+	server.Lock()
+	delete(server.responses, "LIST UPS")
+	server.variables["fake"]["battery.charge"] = "90"
+	server.variables["fake"]["ups.status"] = "OB"
+	server.Unlock()
+	current = current.Add(5 * time.Minute)
+
+	acc = testutil.Accumulator{}
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.False(t, acc.HasTag("upsd", "stale"))
+	reachable, ok := acc.BoolField("upsd", "reachable")
+	require.True(t, ok)
+	require.True(t, reachable)
+	rate, ok := acc.FloatField("upsd", "battery_charge_rate_pct_per_hour")
+	require.True(t, ok)
+	require.InDelta(t, -60.0, rate, 1e-9)
+	require.Equal(t, "on_battery", acc.TagValue("upsd_event", "event"))
+}
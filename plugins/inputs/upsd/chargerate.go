@@ -0,0 +1,28 @@
+package upsd
+
+// addChargeRate adds the battery_charge_rate_pct_per_hour field with the
+// change of the battery charge since the last gather normalized by the
+// elapsed time, making the rate comparable across collection intervals.
+// The field is omitted until the charge of the UPS is known from a
+// previous gather.
+func (u *Upsd) addChargeRate(key string, variables map[string]string, fields map[string]interface{}) {
+	raw := firstOf(variables, "battery.charge", "battery.charge.approx")
+	if raw == "" {
+		return
+	}
+	charge, err := u.parseFloat(raw)
+	if err != nil {
+		return
+	}
+
+	current := now()
+	s, _ := u.state(key)
+	if s.chargeKnown {
+		if elapsed := current.Sub(s.chargeTime); elapsed > 0 {
+			fields["battery_charge_rate_pct_per_hour"] = (charge - s.charge) / elapsed.Hours()
+		}
+	}
+	s.chargeKnown = true
+	s.charge = charge
+	s.chargeTime = current
+}
@@ -0,0 +1,49 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdChargeRate(t *testing.T) {
+	current := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	sequence := []struct {
+		elapsed  time.Duration
+		charge   string
+		expected interface{}
+	}{
+		{charge: "100"},
+		{elapsed: 30 * time.Minute, charge: "90", expected: -20.0},
+		{elapsed: 6 * time.Minute, charge: "89", expected: -10.0},
+		{elapsed: 2 * time.Hour, charge: "89", expected: 0.0},
+		{elapsed: 15 * time.Minute, charge: "94", expected: 20.0},
+	}
+
+	for i, step := range sequence {
+		current = current.Add(step.elapsed)
+
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+			"battery.charge": step.charge,
+			"ups.status":     "OL",
+		})
+		require.NoError(t, acc.FirstError())
+
+		rate, ok := acc.FloatField("upsd", "battery_charge_rate_pct_per_hour")
+		if step.expected == nil {
+			require.False(t, ok, "step %d", i)
+			continue
+		}
+		require.True(t, ok, "step %d", i)
+		require.InDelta(t, step.expected, rate, 1e-9, "step %d", i)
+	}
+}
@@ -0,0 +1,283 @@
+package upsd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// protocolError is returned when upsd answers a command with an ERR line.
+// See: https://networkupstools.org/docs/developer-guide.chunked/ar01s09.html
+type protocolError struct {
+	Command string
+	Code    string
+}
+
+func (e *protocolError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Command, e.Code)
+}
+
+// upsInfo is a single entry of the LIST UPS response.
+type upsInfo struct {
+	Name        string
+	Description string
+}
+
+// client is a minimal implementation of the NUT network protocol
+// sufficient for reading UPS variables.
+type client struct {
+	raw  net.Conn
+	conn *textproto.Conn
+
+	// trace logs the commands sent and lines received if set
+	trace func(format string, args ...interface{})
+
+	// observe records the time until the first line of the response of
+	// each command if set
+	observe func(time.Duration)
+}
+
+func dial(address string, timeout time.Duration) (*client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return &client{raw: conn, conn: textproto.NewConn(conn)}, nil
+}
+
+// startTLS upgrades the connection to TLS, see the STARTTLS command
+func (c *client) startTLS(cfg *tls.Config) error {
+	line, err := c.command("STARTTLS")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK STARTTLS") {
+		return fmt.Errorf("STARTTLS: unexpected response %q", line)
+	}
+
+	tlsConn := tls.Client(c.raw, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.raw = tlsConn
+	c.conn = textproto.NewConn(tlsConn)
+	return nil
+}
+
+// setDeadline sets the deadline of the connection relative to now
+func (c *client) setDeadline(timeout time.Duration) error {
+	return c.raw.SetDeadline(time.Now().Add(timeout))
+}
+
+func (c *client) close() error {
+	return c.conn.Close()
+}
+
+// command sends a single command and returns its one-line response.
+func (c *client) command(cmd string) (string, error) {
+	if c.trace != nil {
+		c.trace("> %s", redactCommand(cmd))
+	}
+	start := time.Now()
+	if err := c.conn.PrintfLine("%s", cmd); err != nil {
+		return "", err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return "", err
+	}
+	if c.observe != nil {
+		c.observe(time.Since(start))
+	}
+	if strings.HasPrefix(line, "ERR ") {
+		return "", &protocolError{Command: commandName(cmd), Code: strings.TrimPrefix(line, "ERR ")}
+	}
+	return line, nil
+}
+
+// list sends a LIST command and returns the lines between BEGIN and END.
+func (c *client) list(cmd string) ([]string, error) {
+	line, err := c.command(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if line != "BEGIN "+cmd {
+		return nil, fmt.Errorf("%s: unexpected response %q", commandName(cmd), line)
+	}
+
+	var lines []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "END "+cmd {
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+func (c *client) readLine() (string, error) {
+	line, err := c.conn.ReadLine()
+	if err == nil && c.trace != nil {
+		c.trace("< %s", line)
+	}
+	return line, err
+}
+
+func (c *client) authenticate(username, password string) error {
+	if _, err := c.command("USERNAME " + username); err != nil {
+		return err
+	}
+	_, err := c.command("PASSWORD " + password)
+	return err
+}
+
+func (c *client) listUPS() ([]upsInfo, error) {
+	lines, err := c.list("LIST UPS")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]upsInfo, 0, len(lines))
+	for _, line := range lines {
+		parts := splitFields(line)
+		if len(parts) < 2 || parts[0] != "UPS" {
+			return nil, fmt.Errorf("LIST UPS: unexpected line %q", line)
+		}
+		info := upsInfo{Name: parts[1]}
+		if len(parts) > 2 {
+			info.Description = parts[2]
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+func (c *client) listVariables(ups string) (map[string]string, error) {
+	lines, err := c.list("LIST VAR " + ups)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(lines))
+	for _, line := range lines {
+		parts := splitFields(line)
+		if len(parts) != 4 || parts[0] != "VAR" || parts[1] != ups {
+			return nil, fmt.Errorf("LIST VAR: unexpected line %q", line)
+		}
+		result[parts[2]] = parts[3]
+	}
+	return result, nil
+}
+
+func (c *client) getVariable(ups, name string) (string, error) {
+	line, err := c.command("GET VAR " + ups + " " + name)
+	if err != nil {
+		return "", err
+	}
+
+	parts := splitFields(line)
+	if len(parts) != 4 || parts[0] != "VAR" || parts[1] != ups || parts[2] != name {
+		return "", fmt.Errorf("GET VAR: unexpected response %q", line)
+	}
+	return parts[3], nil
+}
+
+// listNames sends a LIST command for the given UPS and returns the third
+// field of each response line, e.g. the client address or command name.
+func (c *client) listNames(kind, ups string) ([]string, error) {
+	lines, err := c.list("LIST " + kind + " " + ups)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		parts := splitFields(line)
+		if len(parts) != 3 || parts[0] != kind || parts[1] != ups {
+			return nil, fmt.Errorf("LIST %s: unexpected line %q", kind, line)
+		}
+		result = append(result, parts[2])
+	}
+	return result, nil
+}
+
+func (c *client) listClients(ups string) ([]string, error) {
+	return c.listNames("CLIENT", ups)
+}
+
+func (c *client) listCommands(ups string) ([]string, error) {
+	return c.listNames("CMD", ups)
+}
+
+func (c *client) logout() error {
+	_, err := c.command("LOGOUT")
+	return err
+}
+
+// commandName strips the arguments of a command for use in error messages
+// so that e.g. passwords never end up in the log.
+func commandName(cmd string) string {
+	fields := strings.Fields(cmd)
+	switch {
+	case len(fields) == 0:
+		return cmd
+	case fields[0] == "LIST" && len(fields) > 1:
+		return fields[0] + " " + fields[1]
+	default:
+		return fields[0]
+	}
+}
+
+// redactCommand hides the password of the given command for logging
+func redactCommand(cmd string) string {
+	if strings.HasPrefix(cmd, "PASSWORD ") {
+		return "PASSWORD <redacted>"
+	}
+	return cmd
+}
+
+// splitFields splits a response line at whitespace honoring double-quoted
+// fields and backslash escapes within them.
+func splitFields(line string) []string {
+	var fields []string
+	var current strings.Builder
+	inQuotes, escaped, inField := false, false, false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && inQuotes:
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+			inField = true
+		case r == ' ' && !inQuotes:
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
@@ -0,0 +1,161 @@
+package upsd
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/influxdata/telegraf"
+)
+
+const mdnsService = "_nut._tcp.local."
+const defaultMDNSAddress = "224.0.0.251:5353"
+
+// Time to wait for responses to an mDNS query
+var discoveryWindow = time.Second
+
+// refreshDiscovery browses for NUT servers if the discovery interval elapsed.
+// The previously discovered servers are kept if browsing fails.
+func (u *Upsd) refreshDiscovery(acc telegraf.Accumulator) {
+	if !u.lastDiscovery.IsZero() && now().Sub(u.lastDiscovery) < time.Duration(u.DiscoveryInterval) {
+		return
+	}
+
+	address := u.mdnsAddress
+	if address == "" {
+		address = defaultMDNSAddress
+	}
+
+	endpoints, err := discover(address, discoveryWindow)
+	if err != nil {
+		acc.AddError(fmt.Errorf("discovery: %w", err))
+		return
+	}
+	u.Log.Debugf("Discovered %d NUT server(s)", len(endpoints))
+	u.discovered = endpoints
+	u.lastDiscovery = now()
+}
+
+// discover sends a PTR query for the NUT service and collects all answers
+// received within the given window. The query is sent from an ephemeral port
+// so responders reply via unicast as specified in RFC 6762 section 6.7.
+func discover(address string, window time.Duration) ([]endpoint, error) {
+	group, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query := new(dns.Msg)
+	query.SetQuestion(mdnsService, dns.TypePTR)
+	query.RecursionDesired = false
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(packet, group); err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(window)); err != nil {
+		return nil, err
+	}
+
+	var records []dns.RR
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+
+		var msg dns.Msg
+		if err := msg.Unpack(buf[:n]); err != nil {
+			// Ignore malformed responses of other devices
+			continue
+		}
+		records = append(records, msg.Answer...)
+		records = append(records, msg.Extra...)
+	}
+
+	return resolveServices(records), nil
+}
+
+// resolveServices determines the servers from the PTR, SRV and address
+// records of the mDNS responses.
+func resolveServices(records []dns.RR) []endpoint {
+	instances := make(map[string]bool)
+	services := make(map[string]*dns.SRV)
+	addresses := make(map[string]string)
+	for _, rr := range records {
+		switch r := rr.(type) {
+		case *dns.PTR:
+			if strings.EqualFold(r.Hdr.Name, mdnsService) {
+				instances[r.Ptr] = true
+			}
+		case *dns.SRV:
+			services[r.Hdr.Name] = r
+		case *dns.A:
+			addresses[r.Hdr.Name] = r.A.String()
+		case *dns.AAAA:
+			if _, found := addresses[r.Hdr.Name]; !found {
+				addresses[r.Hdr.Name] = r.AAAA.String()
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	endpoints := make([]endpoint, 0, len(instances))
+	for instance := range instances {
+		srv, ok := services[instance]
+		if !ok {
+			continue
+		}
+		host, ok := addresses[srv.Target]
+		if !ok {
+			host = strings.TrimSuffix(srv.Target, ".")
+		}
+
+		ep := endpoint{host: host, port: int(srv.Port), tagged: true}
+		if seen[ep.address()] {
+			continue
+		}
+		seen[ep.address()] = true
+		endpoints = append(endpoints, ep)
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].address() < endpoints[j].address()
+	})
+	return endpoints
+}
+
+// mergeDiscovered appends the discovered endpoints to the configured ones
+// skipping servers already configured, so that servers both configured and
+// advertised are only collected once using their configured settings.
+func mergeDiscovered(configured, discovered []endpoint) []endpoint {
+	seen := make(map[string]bool, len(configured))
+	for _, ep := range configured {
+		seen[ep.address()] = true
+	}
+
+	endpoints := append([]endpoint{}, configured...)
+	for _, ep := range discovered {
+		if !seen[ep.address()] {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	return endpoints
+}
@@ -0,0 +1,131 @@
+package upsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+// fakeResponder answers mDNS PTR queries for the NUT service
+func fakeResponder(t *testing.T, ports ...int) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		reply := new(dns.Msg)
+		reply.SetReply(r)
+		for i, port := range ports {
+			instance := []string{"first", "second"}[i] + "." + mdnsService
+			target := []string{"first", "second"}[i] + ".local."
+			reply.Answer = append(reply.Answer, &dns.PTR{
+				Hdr: dns.RR_Header{Name: mdnsService, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 120},
+				Ptr: instance,
+			})
+			reply.Extra = append(reply.Extra,
+				&dns.SRV{
+					Hdr:    dns.RR_Header{Name: instance, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120},
+					Target: target,
+					Port:   uint16(port),
+				},
+				&dns.A{
+					Hdr: dns.RR_Header{Name: target, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 120},
+					A:   net.ParseIP("127.0.0.1"),
+				},
+			)
+		}
+		require.NoError(t, w.WriteMsg(reply))
+	})
+
+	server := &dns.Server{PacketConn: pc, Handler: handler}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+func TestUpsdDiscovery(t *testing.T) {
+	discoveryWindow = 200 * time.Millisecond
+	defer func() { discoveryWindow = time.Second }()
+
+	first := newMockServer()
+	first.addUps("ups1", map[string]string{"ups.status": "OL"})
+	firstAddr := first.listen(t)
+
+	second := newMockServer()
+	second.addUps("ups2", map[string]string{"ups.status": "OB"})
+	secondAddr := second.listen(t)
+
+	plugin := &Upsd{
+		Discovery:         true,
+		DiscoveryInterval: defaultDiscoveryInterval,
+		mdnsAddress:       fakeResponder(t, firstAddr.Port, secondAddr.Port),
+		Log:               testutil.Logger{},
+	}
+
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.Len(t, plugin.discovered, 2)
+
+	servers := make(map[string]string)
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() != "upsd" {
+			continue
+		}
+		name, _ := m.GetTag("ups_name")
+		server, _ := m.GetTag("server")
+		servers[name] = server
+	}
+	require.Equal(t, map[string]string{
+		"ups1": firstAddr.String(),
+		"ups2": secondAddr.String(),
+	}, servers)
+}
+
+func TestUpsdDiscoveryConfiguredServer(t *testing.T) {
+	discoveryWindow = 200 * time.Millisecond
+	defer func() { discoveryWindow = time.Second }()
+
+	first := newMockServer()
+	first.addUps("ups1", map[string]string{"ups.status": "OL"})
+	firstAddr := first.listen(t)
+
+	second := newMockServer()
+	second.addUps("ups2", map[string]string{"ups.status": "OB"})
+	secondAddr := second.listen(t)
+
+	plugin := &Upsd{
+		Servers:           []string{firstAddr.String()},
+		Discovery:         true,
+		DiscoveryInterval: defaultDiscoveryInterval,
+		mdnsAddress:       fakeResponder(t, firstAddr.Port, secondAddr.Port),
+		Log:               testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	// The configured server also advertised via mDNS is collected once
+	counts := make(map[string]int)
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "upsd" {
+			name, _ := m.GetTag("ups_name")
+			counts[name]++
+		}
+	}
+	require.Equal(t, map[string]int{"ups1": 1, "ups2": 1}, counts)
+	acc.AssertContainsFields(t, "upsd_servers", map[string]interface{}{
+		"configured":      2,
+		"reachable":       2,
+		"reachable_ratio": 1.0,
+	})
+}
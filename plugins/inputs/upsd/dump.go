@@ -0,0 +1,72 @@
+package upsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/influxdata/telegraf/internal/rotate"
+)
+
+// Number of rotated debug dump files to keep
+const debugDumpArchives = 1
+
+var defaultDebugDumpMaxSize = int64(10 * 1024 * 1024)
+
+// dumpEntry is a single line of the debug dump
+type dumpEntry struct {
+	Timestamp string            `json:"timestamp"`
+	Server    string            `json:"server"`
+	Ups       string            `json:"ups"`
+	Variables map[string]string `json:"variables"`
+}
+
+// writeDebugDump appends the variables of all UPSes of the given server to
+// the debug dump file, one JSON object per line.
+func (u *Upsd) writeDebugDump(ep endpoint, upsList map[string]map[string]string) error {
+	if u.dump == nil {
+		maxSize := int64(u.DebugDumpMaxSize)
+		if maxSize <= 0 {
+			maxSize = defaultDebugDumpMaxSize
+		}
+		w, err := rotate.NewFileWriter(u.DebugDumpPath, 0, maxSize, debugDumpArchives)
+		if err != nil {
+			return fmt.Errorf("opening %q failed: %w", u.DebugDumpPath, err)
+		}
+		u.dump = w
+	}
+
+	names := make([]string, 0, len(upsList))
+	for name := range upsList {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	timestamp := now().UTC().Format(time.RFC3339Nano)
+	for _, name := range names {
+		line, err := json.Marshal(dumpEntry{
+			Timestamp: timestamp,
+			Server:    ep.address(),
+			Ups:       name,
+			Variables: upsList[name],
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := u.dump.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *Upsd) closeDebugDump() {
+	if u.dump == nil {
+		return
+	}
+	if err := u.dump.Close(); err != nil {
+		u.Log.Errorf("Closing debug dump failed: %v", err)
+	}
+	u.dump = nil
+}
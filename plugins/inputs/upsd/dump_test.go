@@ -0,0 +1,64 @@
+package upsd
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdDebugDump(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake1", map[string]string{
+		"battery.charge": "100",
+		"ups.status":     "OL",
+	})
+	server.addUps("fake2", map[string]string{
+		"ups.mfr":    "Vendor Inc.",
+		"ups.status": "OB LB",
+	})
+	addr := server.listen(t)
+
+	path := filepath.Join(t.TempDir(), "dump.jsonl")
+	plugin := &Upsd{
+		Server:        addr.IP.String(),
+		Port:          addr.Port,
+		DebugDumpPath: path,
+		Log:           testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, plugin.Gather(&acc))
+	defer plugin.Stop()
+	require.NoError(t, acc.FirstError())
+	require.True(t, acc.HasMeasurement("upsd"))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var entries []dumpEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		require.True(t, json.Valid(scanner.Bytes()), scanner.Text())
+		var entry dumpEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, entries, 4)
+	for i, entry := range entries {
+		require.Equal(t, addr.String(), entry.Server)
+		require.Equal(t, []string{"fake1", "fake2"}[i%2], entry.Ups)
+		require.Equal(t, server.variables[entry.Ups], entry.Variables)
+		require.NotEmpty(t, entry.Timestamp)
+	}
+}
@@ -0,0 +1,64 @@
+package upsd
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+)
+
+var efficiencyVariable = regexp.MustCompile(`^ups\.efficiency\.(\d+)$`)
+
+// measuredEfficiency returns the efficiency in percent computed from the
+// input and output real power.
+func (u *Upsd) measuredEfficiency(variables map[string]string) (float64, bool) {
+	input, errInput := u.parseFloat(variables["input.realpower"])
+	output, errOutput := u.parseFloat(variables["output.realpower"])
+	if errInput != nil || errOutput != nil || input == 0 {
+		return 0, false
+	}
+	return 100 * output / input, true
+}
+
+// loadPoints returns the sorted load points of the variables matching the
+// given pattern with the load point as first submatch.
+func loadPoints(pattern *regexp.Regexp, variables map[string]string) []int {
+	var points []int
+	for key := range variables {
+		match := pattern.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		point, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		points = append(points, point)
+	}
+	sort.Ints(points)
+	return points
+}
+
+// gatherEfficiency adds an upsd_efficiency metric for each point of the
+// efficiency curve given as ups.efficiency.N with N being the load point
+// in percent. A single point does not form a curve and is skipped.
+func (u *Upsd) gatherEfficiency(acc telegraf.Accumulator, variables map[string]string, upsTags map[string]string) {
+	points := loadPoints(efficiencyVariable, variables)
+	if len(points) < 2 {
+		return
+	}
+
+	for _, point := range points {
+		loadPoint := strconv.Itoa(point)
+		fields := make(map[string]interface{})
+		u.addNumber(acc, fields, "efficiency_percent", "ups.efficiency."+loadPoint, variables)
+		if len(fields) == 0 {
+			continue
+		}
+
+		tags := derivedTags(upsTags)
+		tags["load_point"] = loadPoint
+		u.addFields(acc, "upsd_efficiency", fields, tags)
+	}
+}
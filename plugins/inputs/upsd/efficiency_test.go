@@ -0,0 +1,112 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdGatherEfficiency(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"device.serial":      "ABC123",
+		"ups.efficiency":     "94",
+		"ups.efficiency.25":  "91.5",
+		"ups.efficiency.50":  "94.2",
+		"ups.efficiency.100": "95",
+		"ups.status":         "OL",
+	})
+	require.NoError(t, acc.FirstError())
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd_efficiency",
+			map[string]string{"ups_name": "fake", "serial": "ABC123", "load_point": "25"},
+			map[string]interface{}{"efficiency_percent": 91.5},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd_efficiency",
+			map[string]string{"ups_name": "fake", "serial": "ABC123", "load_point": "50"},
+			map[string]interface{}{"efficiency_percent": 94.2},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd_efficiency",
+			map[string]string{"ups_name": "fake", "serial": "ABC123", "load_point": "100"},
+			map[string]interface{}{"efficiency_percent": int64(95)},
+			time.Unix(0, 0),
+		),
+	}
+
+	var actual []telegraf.Metric
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "upsd_efficiency" {
+			actual = append(actual, m)
+		}
+	}
+	testutil.RequireMetricsEqual(t, expected, actual, testutil.IgnoreTime())
+}
+
+func TestUpsdGatherEfficiencySinglePoint(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	for _, variables := range []map[string]string{
+		{"ups.status": "OL"},
+		{"ups.efficiency": "94", "ups.status": "OL"},
+		{"ups.efficiency.50": "94", "ups.status": "OL"},
+	} {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+		require.NoError(t, acc.FirstError())
+		require.False(t, acc.HasMeasurement("upsd_efficiency"))
+	}
+}
+
+func TestUpsdGatherMeasuredEfficiency(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"input.realpower":  "500",
+		"output.realpower": "460",
+		"ups.status":       "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	efficiency, ok := acc.FloatField("upsd", "measured_efficiency_percent")
+	require.True(t, ok)
+	require.InDelta(t, 92.0, efficiency, 1e-9)
+	input, ok := acc.Int64Field("upsd", "input_real_power")
+	require.True(t, ok)
+	require.Equal(t, int64(500), input)
+	output, ok := acc.Int64Field("upsd", "output_real_power")
+	require.True(t, ok)
+	require.Equal(t, int64(460), output)
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"input.realpower":  "0",
+		"output.realpower": "0",
+		"ups.status":       "OB",
+	})
+	require.NoError(t, acc.FirstError())
+	require.False(t, acc.HasField("upsd", "measured_efficiency_percent"))
+
+	plugin = &Upsd{DecimalSeparator: ",", Log: testutil.Logger{}}
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"input.realpower":  "500,0",
+		"output.realpower": "460,0",
+		"ups.status":       "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	efficiency, ok = acc.FloatField("upsd", "measured_efficiency_percent")
+	require.True(t, ok)
+	require.InDelta(t, 92.0, efficiency, 1e-9)
+}
@@ -0,0 +1,113 @@
+package upsd
+
+import (
+	"crypto/x509"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/choice"
+)
+
+// Error codes of the NUT protocol caused by the configuration of the
+// plugin or the server rather than by a transient condition
+var fatalProtocolCodes = []string{
+	"ACCESS-DENIED",
+	"UNKNOWN-UPS",
+	"USERNAME-REQUIRED",
+	"PASSWORD-REQUIRED",
+	"INVALID-USERNAME",
+	"INVALID-PASSWORD",
+	"UNKNOWN-COMMAND",
+	"INVALID-ARGUMENT",
+	"FEATURE-NOT-SUPPORTED",
+	"FEATURE-NOT-CONFIGURED",
+	"TLS-NOT-ENABLED",
+	"ALREADY-SSL-MODE",
+}
+
+// gRPC status codes caused by the configuration of the plugin or the server
+var fatalGRPCCodes = []codes.Code{
+	codes.InvalidArgument,
+	codes.NotFound,
+	codes.PermissionDenied,
+	codes.Unauthenticated,
+	codes.Unimplemented,
+}
+
+// errorCounts holds the number of failed gathers of a server by class
+type errorCounts struct {
+	recoverable int64
+	fatal       int64
+}
+
+// isRecoverable checks if the error is likely to go away when retrying,
+// e.g. a flaky network or a driver not yet connected, as opposed to fatal
+// errors requiring a change of the configuration or the permissions.
+func isRecoverable(err error) bool {
+	var perr *protocolError
+	if errors.As(err, &perr) {
+		return !choice.Contains(perr.Code, fatalProtocolCodes)
+	}
+
+	if s, ok := status.FromError(err); ok && s.Code() != codes.OK {
+		for _, code := range fatalGRPCCodes {
+			if s.Code() == code {
+				return false
+			}
+		}
+		return true
+	}
+
+	var certErr x509.CertificateInvalidError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &certErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.Temporary() || dnsErr.Timeout()
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || isClosedConnection(err)
+}
+
+// countError records the error of a failed gather of the given server
+func (u *Upsd) countError(ep endpoint, err error) {
+	if u.errorCounts == nil {
+		u.errorCounts = make(map[string]*errorCounts)
+	}
+	address := ep.address()
+	counts, ok := u.errorCounts[address]
+	if !ok {
+		counts = &errorCounts{}
+		u.errorCounts[address] = counts
+	}
+
+	if isRecoverable(err) {
+		counts.recoverable++
+	} else {
+		counts.fatal++
+	}
+}
+
+// gatherErrors emits the upsd_errors metric with the number of recoverable
+// and fatal errors since startup for each of the given servers.
+func (u *Upsd) gatherErrors(acc telegraf.Accumulator, endpoints []endpoint) {
+	for _, ep := range endpoints {
+		var counts errorCounts
+		if c, ok := u.errorCounts[ep.address()]; ok {
+			counts = *c
+		}
+		u.addFields(acc, "upsd_errors", map[string]interface{}{
+			"recoverable": counts.recoverable,
+			"fatal":       counts.fatal,
+		}, map[string]string{"server": ep.address()})
+	}
+}
@@ -0,0 +1,77 @@
+package upsd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestIsRecoverable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"driver not connected", &protocolError{Command: "LIST UPS", Code: "DRIVER-NOT-CONNECTED"}, true},
+		{"data stale", fmt.Errorf("fake: %w", &protocolError{Command: "LIST VAR", Code: "DATA-STALE"}), true},
+		{"access denied", &protocolError{Command: "LIST UPS", Code: "ACCESS-DENIED"}, false},
+		{"invalid password", &protocolError{Command: "PASSWORD", Code: "INVALID-PASSWORD"}, false},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"closed connection", fmt.Errorf("reading failed: %w", io.EOF), true},
+		{"unknown host", &net.DNSError{Err: "no such host", Name: "ups.invalid", IsNotFound: true}, false},
+		{"grpc unavailable", status.Error(codes.Unavailable, "connection refused"), true},
+		{"grpc permission denied", status.Error(codes.PermissionDenied, "forbidden"), false},
+		{"unexpected response", errors.New("unexpected response"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, isRecoverable(tt.err))
+		})
+	}
+}
+
+func TestUpsdErrorCounts(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:      addr.IP.String(),
+		Port:        addr.Port,
+		ErrorCounts: true,
+		Log:         testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	gather := func(response string, recoverable, fatal int64) {
+		server.Lock()
+		if response == "" {
+			delete(server.responses, "LIST UPS")
+		} else {
+			server.responses["LIST UPS"] = response
+		}
+		server.Unlock()
+
+		var acc testutil.Accumulator
+		require.NoError(t, plugin.Gather(&acc))
+		acc.AssertContainsTaggedFields(t, "upsd_errors", map[string]interface{}{
+			"recoverable": recoverable,
+			"fatal":       fatal,
+		}, map[string]string{"server": addr.String()})
+	}
+
+	gather("ERR DRIVER-NOT-CONNECTED\n", 1, 0)
+	gather("ERR DRIVER-NOT-CONNECTED\n", 2, 0)
+	gather("ERR ACCESS-DENIED\n", 2, 1)
+
+	// Successful gathers keep the counters
+	gather("", 2, 1)
+}
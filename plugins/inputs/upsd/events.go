@@ -0,0 +1,90 @@
+package upsd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/choice"
+)
+
+// upsState holds the state of a single UPS kept across gathers
+type upsState struct {
+	onBattery  bool
+	lowBattery bool
+
+	beeperKnown bool
+	beeperMuted bool
+
+	variablesKnown bool
+	variablesHash  uint64
+
+	chargeKnown bool
+	charge      float64
+	chargeTime  time.Time
+
+	statusKnown bool
+	statusFlags uint64
+
+	// Time of the last collection for the interval of accelerated samples
+	collected time.Time
+
+	// Runtime variables clamped in the last gather, warned about once
+	clamped map[string]bool
+}
+
+// state returns the state of the given UPS and whether it was seen before
+func (u *Upsd) state(key string) (*upsState, bool) {
+	if u.states == nil {
+		u.states = make(map[string]*upsState)
+	}
+	s, found := u.states[key]
+	if !found {
+		s = &upsState{}
+		u.states[key] = s
+	}
+	return s, found
+}
+
+// addStatusChange adds the status_changed_bits field with the status
+// bits flipped since the last gather. The field is omitted on the first
+// gather of a UPS.
+func (u *Upsd) addStatusChange(key string, status uint64, fields map[string]interface{}) {
+	s, _ := u.state(key)
+	if s.statusKnown {
+		fields["status_changed_bits"] = status ^ s.statusFlags
+	}
+	s.statusKnown = true
+	s.statusFlags = status
+}
+
+// emitEvents adds an upsd_event metric for each power transition of the UPS
+// since the last gather. No events are emitted on the first gather.
+func (u *Upsd) emitEvents(acc telegraf.Accumulator, key string, variables map[string]string, tags map[string]string) {
+	statuses := strings.Fields(variables["ups.status"])
+	onBattery := choice.Contains("OB", statuses)
+	online := choice.Contains("OL", statuses)
+	lowBattery := choice.Contains("LB", statuses)
+
+	s, found := u.state(key)
+	var events []string
+	if found {
+		if onBattery && !s.onBattery {
+			events = append(events, "on_battery")
+		}
+		if online && s.onBattery {
+			events = append(events, "back_online")
+		}
+		if lowBattery && !s.lowBattery {
+			events = append(events, "low_battery")
+		}
+	}
+	s.onBattery = onBattery && !online
+	s.lowBattery = lowBattery
+
+	for _, event := range events {
+		eventTags := derivedTags(tags)
+		eventTags["event"] = event
+		u.addFields(acc, "upsd_event", map[string]interface{}{"ups_status": variables["ups.status"]}, eventTags)
+	}
+}
@@ -0,0 +1,79 @@
+package upsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdEvents(t *testing.T) {
+	plugin := &Upsd{EmitEvents: true, Log: testutil.Logger{}}
+
+	sequence := []struct {
+		status   string
+		expected []string
+	}{
+		{status: "OL"},
+		{status: "OL"},
+		{status: "OB", expected: []string{"on_battery"}},
+		{status: "OB"},
+		{status: "OB LB", expected: []string{"low_battery"}},
+		{status: "OB LB"},
+		{status: "OL CHRG", expected: []string{"back_online"}},
+		{status: "OL"},
+		{status: "OB LB", expected: []string{"on_battery", "low_battery"}},
+	}
+
+	for i, step := range sequence {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+			"device.serial": "ABC123",
+			"ups.status":    step.status,
+		})
+		require.NoError(t, acc.FirstError())
+
+		var events []string
+		for _, m := range acc.GetTelegrafMetrics() {
+			if m.Name() != "upsd_event" {
+				continue
+			}
+			event, _ := m.GetTag("event")
+			events = append(events, event)
+			require.Equal(t, map[string]string{"event": event, "ups_name": "fake", "serial": "ABC123"}, m.Tags())
+		}
+		require.Equal(t, step.expected, events, "step %d (%s)", i, step.status)
+	}
+}
+
+func TestUpsdStatusChangedBits(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	// Bits: 3 = OL, 4 = OB, 6 = LB
+	sequence := []struct {
+		status   string
+		expected interface{}
+	}{
+		{status: "OL"},
+		{status: "OL", expected: uint64(0)},
+		{status: "OB", expected: uint64(1<<3 | 1<<4)},
+		{status: "OB LB", expected: uint64(1 << 6)},
+		{status: "OL", expected: uint64(1<<3 | 1<<4 | 1<<6)},
+		{status: "OL CHRG", expected: uint64(0)},
+	}
+
+	for i, step := range sequence {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": step.status})
+		require.NoError(t, acc.FirstError())
+
+		changed, ok := acc.Uint64Field("upsd", "status_changed_bits")
+		if step.expected == nil {
+			require.False(t, ok, "step %d", i)
+			continue
+		}
+		require.True(t, ok, "step %d", i)
+		require.Equal(t, step.expected, changed, "step %d", i)
+	}
+}
@@ -0,0 +1,67 @@
+package upsd
+
+import (
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/choice"
+)
+
+// fleetStats collects the worst-case values across all UPSes of a gather
+type fleetStats struct {
+	ups       int
+	onBattery int
+
+	chargeKnown bool
+	minCharge   float64
+
+	runtimeKnown bool
+	minRuntime   int64
+}
+
+// add includes a UPS with the given status and fields in the statistics
+func (f *fleetStats) add(status string, fields map[string]interface{}) {
+	f.ups++
+	if choice.Contains("OB", strings.Fields(status)) {
+		f.onBattery++
+	}
+
+	charge, ok := 0.0, true
+	switch v := fields["battery_charge_percent"].(type) {
+	case int64:
+		charge = float64(v)
+	case float64:
+		charge = v
+	default:
+		ok = false
+	}
+	if ok && (!f.chargeKnown || charge < f.minCharge) {
+		f.minCharge = charge
+		f.chargeKnown = true
+	}
+
+	if runtime, ok := fields["time_left_ns"].(int64); ok && (!f.runtimeKnown || runtime < f.minRuntime) {
+		f.minRuntime = runtime
+		f.runtimeKnown = true
+	}
+}
+
+// gatherFleet emits the upsd_fleet metric with the worst-case values
+// across all servers and UPSes collected in this gather.
+func (u *Upsd) gatherFleet(acc telegraf.Accumulator) {
+	if u.fleet.ups == 0 {
+		return
+	}
+
+	fields := map[string]interface{}{
+		"ups":        u.fleet.ups,
+		"on_battery": u.fleet.onBattery,
+	}
+	if u.fleet.chargeKnown {
+		fields["min_battery_charge_percent"] = u.fleet.minCharge
+	}
+	if u.fleet.runtimeKnown {
+		fields["min_time_left_ns"] = u.fleet.minRuntime
+	}
+	u.addFields(acc, "upsd_fleet", fields, nil)
+}
@@ -0,0 +1,69 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdFleetSummary(t *testing.T) {
+	server1 := newMockServer()
+	server1.addUps("fake1", map[string]string{
+		"battery.charge":  "100",
+		"battery.runtime": "1200",
+		"ups.status":      "OL",
+	})
+	server1.addUps("fake2", map[string]string{
+		"battery.charge":  "42.5",
+		"battery.runtime": "900",
+		"ups.status":      "OB DISCHRG",
+	})
+	server2 := newMockServer()
+	server2.addUps("fake3", map[string]string{
+		"battery.charge":  "80",
+		"battery.runtime": "300",
+		"ups.status":      "OB LB",
+	})
+	server2.addUps("fake4", map[string]string{"ups.status": "OL"})
+
+	plugin := &Upsd{
+		Servers:      []string{server1.listen(t).String(), server2.listen(t).String()},
+		FleetSummary: true,
+		Log:          testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	acc.AssertContainsFields(t, "upsd_fleet", map[string]interface{}{
+		"ups":                        4,
+		"on_battery":                 2,
+		"min_battery_charge_percent": 42.5,
+		"min_time_left_ns":           int64(300 * time.Second),
+	})
+
+	// The statistics are reset on each gather
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(&acc))
+	ups, ok := acc.IntField("upsd_fleet", "ups")
+	require.True(t, ok)
+	require.Equal(t, 4, ups)
+}
+
+func TestUpsdFleetSummaryDisabled(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{Server: addr.IP.String(), Port: addr.Port, Log: testutil.Logger{}}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.False(t, acc.HasMeasurement("upsd_fleet"))
+}
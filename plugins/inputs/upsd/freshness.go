@@ -0,0 +1,42 @@
+package upsd
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// hashVariables computes a hash over all variables of a UPS independent of
+// the order of the map.
+func hashVariables(variables map[string]string) uint64 {
+	keys := make([]string, 0, len(variables))
+	for key := range variables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	for _, key := range keys {
+		// Separate the entries by NUL bytes which cannot occur in the
+		// protocol so that different maps never produce the same input
+		_, _ = h.Write([]byte(key))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(variables[key]))
+		_, _ = h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// addDataAdvanced adds the data_advanced field reporting whether any of the
+// variables changed since the last gather. A UPS reporting identical
+// values over and over again hints at a frozen driver. The field is omitted
+// on the first gather of a UPS.
+func (u *Upsd) addDataAdvanced(key string, variables map[string]string, fields map[string]interface{}) {
+	hash := hashVariables(variables)
+
+	s, _ := u.state(key)
+	if s.variablesKnown {
+		fields["data_advanced"] = hash != s.variablesHash
+	}
+	s.variablesKnown = true
+	s.variablesHash = hash
+}
@@ -0,0 +1,74 @@
+package upsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestHashVariables(t *testing.T) {
+	a := map[string]string{"ups.status": "OL", "battery.charge": "100"}
+	b := map[string]string{"battery.charge": "100", "ups.status": "OL"}
+	require.Equal(t, hashVariables(a), hashVariables(b))
+
+	// Moving characters between key and value changes the hash
+	c := map[string]string{"ups.status": "OL", "battery.charge1": "00"}
+	require.NotEqual(t, hashVariables(a), hashVariables(c))
+}
+
+func TestUpsdDataAdvanced(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	sequence := []struct {
+		variables map[string]string
+		expected  interface{}
+	}{
+		{variables: map[string]string{"battery.charge": "100", "ups.status": "OL"}},
+		{variables: map[string]string{"battery.charge": "100", "ups.status": "OL"}, expected: false},
+		{variables: map[string]string{"battery.charge": "100", "ups.status": "OL"}, expected: false},
+		{variables: map[string]string{"battery.charge": "99", "ups.status": "OL"}, expected: true},
+		{variables: map[string]string{"battery.charge": "99", "ups.status": "OL", "ups.load": "8"}, expected: true},
+		{variables: map[string]string{"battery.charge": "99", "ups.status": "OL", "ups.load": "8"}, expected: false},
+	}
+
+	for i, step := range sequence {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", step.variables)
+		require.NoError(t, acc.FirstError())
+
+		advanced, ok := acc.BoolField("upsd", "data_advanced")
+		if step.expected == nil {
+			require.False(t, ok, "step %d", i)
+			continue
+		}
+		require.True(t, ok, "step %d", i)
+		require.Equal(t, step.expected, advanced, "step %d", i)
+	}
+}
+
+func TestUpsdVariablesHash(t *testing.T) {
+	plugin := &Upsd{VariablesHash: true, Log: testutil.Logger{}}
+
+	gatherHash := func(variables map[string]string) string {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+		require.NoError(t, acc.FirstError())
+		hash, ok := acc.StringField("upsd", "variables_hash")
+		require.True(t, ok)
+		return hash
+	}
+
+	hash := gatherHash(map[string]string{"battery.charge": "100", "ups.load": "8", "ups.status": "OL"})
+	require.Len(t, hash, 16)
+
+	// The hash is deterministic and independent of the map order
+	for i := 0; i < 10; i++ {
+		require.Equal(t, hash, gatherHash(map[string]string{"ups.status": "OL", "ups.load": "8", "battery.charge": "100"}))
+	}
+	// Pinned value to detect changes of the hash across releases
+	require.Equal(t, "5ca23cd60fb0b664", hash)
+
+	require.NotEqual(t, hash, gatherHash(map[string]string{"battery.charge": "99", "ups.load": "8", "ups.status": "OL"}))
+}
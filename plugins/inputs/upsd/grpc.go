@@ -0,0 +1,99 @@
+package upsd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Backends for collecting the variables
+const (
+	backendNUT  = "nut"
+	backendGRPC = "grpc"
+)
+
+// Method of the gateway taking a google.protobuf.Empty request and returning
+// a google.protobuf.Struct mapping the UPS names to a struct of their
+// variables with string values.
+const grpcListVariablesMethod = "/upsd.NUT/ListVariables"
+
+// dialGRPC connects to the gRPC gateway unless already connected. The
+// connection is established lazily and kept across gathers.
+func (u *Upsd) dialGRPC() (*grpc.ClientConn, error) {
+	if u.grpcConn != nil {
+		return u.grpcConn, nil
+	}
+
+	tlsConfig, err := u.ClientConfig.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	opt := grpc.WithInsecure()
+	if tlsConfig != nil {
+		opt = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+
+	conn, err := grpc.Dial(u.GRPCEndpoint, opt)
+	if err != nil {
+		return nil, err
+	}
+	u.grpcConn = conn
+	return conn, nil
+}
+
+// fetchGRPC reads the variables of all UPSes from the gRPC gateway
+func (u *Upsd) fetchGRPC() (map[string]map[string]string, error) {
+	conn, err := u.dialGRPC()
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	ctx := context.Background()
+	if u.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(u.Timeout))
+		defer cancel()
+	}
+
+	var response structpb.Struct
+	if err := conn.Invoke(ctx, grpcListVariablesMethod, &emptypb.Empty{}, &response); err != nil {
+		return nil, fmt.Errorf("list variables: %w", err)
+	}
+
+	result := make(map[string]map[string]string, len(response.Fields))
+	for name, value := range response.Fields {
+		ups := value.GetStructValue()
+		if ups == nil {
+			return nil, fmt.Errorf("list variables: unexpected value for %q", name)
+		}
+
+		variables := make(map[string]string, len(ups.Fields))
+		for key, v := range ups.Fields {
+			raw, ok := v.GetKind().(*structpb.Value_StringValue)
+			if !ok {
+				return nil, fmt.Errorf("list variables: unexpected value of %s for %q", key, name)
+			}
+			if u.LightweightMode && indexOf(key, lightweightVariables) < 0 {
+				continue
+			}
+			variables[key] = raw.StringValue
+		}
+		result[name] = variables
+	}
+	return result, nil
+}
+
+func (u *Upsd) closeGRPC() {
+	if u.grpcConn == nil {
+		return
+	}
+	if err := u.grpcConn.Close(); err != nil {
+		u.Log.Errorf("Closing gRPC connection failed: %v", err)
+	}
+	u.grpcConn = nil
+}
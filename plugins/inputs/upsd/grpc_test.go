@@ -0,0 +1,125 @@
+package upsd
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+// gatewayStub implements the ListVariables method of the gRPC gateway
+type gatewayStub struct {
+	variables map[string]map[string]string
+}
+
+func (s *gatewayStub) listVariables(_ context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	upsList := make(map[string]interface{}, len(s.variables))
+	for name, variables := range s.variables {
+		ups := make(map[string]interface{}, len(variables))
+		for key, value := range variables {
+			ups[key] = value
+		}
+		upsList[name] = ups
+	}
+	return structpb.NewStruct(upsList)
+}
+
+func (s *gatewayStub) listen(t *testing.T) string {
+	type gateway interface{}
+	desc := grpc.ServiceDesc{
+		ServiceName: "upsd.NUT",
+		HandlerType: (*gateway)(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "ListVariables",
+				Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+					var in emptypb.Empty
+					if err := dec(&in); err != nil {
+						return nil, err
+					}
+					return srv.(*gatewayStub).listVariables(ctx, &in)
+				},
+			},
+		},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	server.RegisterService(&desc, s)
+	go server.Serve(listener) //nolint:errcheck // Ignore the returned error as we cannot do anything about it anyway
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String()
+}
+
+func TestUpsdGRPCBackend(t *testing.T) {
+	gateway := &gatewayStub{
+		variables: map[string]map[string]string{
+			"fake1": {
+				"battery.charge":  "100",
+				"battery.runtime": "600",
+				"ups.status":      "OL",
+				"ups.serial":      "ABC123",
+			},
+		},
+	}
+	addr := gateway.listen(t)
+
+	plugin := &Upsd{
+		Backend:      backendGRPC,
+		GRPCEndpoint: addr,
+		Timeout:      defaultTimeout,
+		Log:          testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+	defer plugin.Stop()
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	acc.AssertContainsTaggedFields(t, "upsd",
+		map[string]interface{}{
+			"battery_charge_percent": int64(100),
+			"status_flags":           uint64(1 << 3),
+			"status_unknown_tokens":  0,
+			"time_left_ns":           int64(600_000_000_000),
+			"ups_status":             "OL",
+		},
+		map[string]string{
+			"server":    addr,
+			"serial":    "ABC123",
+			"status_OL": "true",
+			"ups_name":  "fake1",
+		},
+	)
+	acc.AssertContainsFields(t, "upsd_servers", map[string]interface{}{
+		"configured":      1,
+		"reachable":       1,
+		"reachable_ratio": 1.0,
+	})
+}
+
+func TestUpsdGRPCBackendInvalid(t *testing.T) {
+	plugin := &Upsd{
+		Backend: backendGRPC,
+		Log:     testutil.Logger{},
+	}
+	require.EqualError(t, plugin.Init(), "grpc_endpoint required for the grpc backend")
+
+	plugin = &Upsd{
+		Backend: "snmp",
+		Server:  defaultAddress,
+		Port:    defaultPort,
+		Log:     testutil.Logger{},
+	}
+	require.EqualError(t, plugin.Init(), `invalid backend "snmp"`)
+}
@@ -0,0 +1,96 @@
+package upsd
+
+import (
+	"time"
+)
+
+// Weights of the individual inputs of the battery health score. If inputs
+// are missing, the score is computed from the remaining ones with the
+// weights scaled accordingly.
+const (
+	healthWeightAge     = 0.3
+	healthWeightCharge  = 0.2
+	healthWeightPacks   = 0.3
+	healthWeightVoltage = 0.2
+)
+
+// Minimum number of inputs required to compute a meaningful score
+const healthMinInputs = 3
+
+// Battery age at which the age score reaches zero
+const healthMaxBatteryAge = 5 * 365 * 24 * time.Hour
+
+// Ratio of battery to nominal voltage at which the voltage score reaches zero
+const healthMinVoltageRatio = 0.85
+
+// Formats used by drivers for battery.date, battery.mfr.date and ups.mfr.date
+var dateFormats = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"01/02/2006",
+	"01/02/06",
+}
+
+func parseDate(raw string) (time.Time, error) {
+	var lastErr error
+	for _, format := range dateFormats {
+		t, err := time.Parse(format, raw)
+		if err == nil {
+			return t, nil
+		}
+		lastErr = err
+	}
+	return time.Time{}, lastErr
+}
+
+// batteryHealthScore computes a score between 0 (bad) and 100 (good) from
+// the battery age, the charge, the ratio of bad battery packs and the
+// battery voltage relative to its nominal value. The second return value
+// is false if not enough inputs are available.
+func (u *Upsd) batteryHealthScore(variables map[string]string) (float64, bool) {
+	var score, weights float64
+	var inputs int
+	add := func(value, weight float64) {
+		score += clamp(value, 0, 100) * weight
+		weights += weight
+		inputs++
+	}
+
+	if raw := firstOf(variables, "battery.date", "battery.mfr.date"); raw != "" {
+		if date, err := parseDate(raw); err == nil {
+			age := now().Sub(date)
+			add(100*(1-float64(age)/float64(healthMaxBatteryAge)), healthWeightAge)
+		}
+	}
+
+	if charge, err := u.parseFloat(variables["battery.charge"]); err == nil {
+		add(charge, healthWeightCharge)
+	}
+
+	packs, errPacks := u.parseFloat(variables["battery.packs"])
+	bad, errBad := u.parseFloat(variables["battery.packs.bad"])
+	if errPacks == nil && errBad == nil && packs > 0 {
+		add(100*(1-bad/packs), healthWeightPacks)
+	}
+
+	voltage, errVoltage := u.parseFloat(variables["battery.voltage"])
+	nominal, errNominal := u.parseFloat(variables["battery.voltage.nominal"])
+	if errVoltage == nil && errNominal == nil && nominal > 0 {
+		add(100*(voltage/nominal-healthMinVoltageRatio)/(1-healthMinVoltageRatio), healthWeightVoltage)
+	}
+
+	if inputs < healthMinInputs {
+		return 0, false
+	}
+	return score / weights, true
+}
+
+func clamp(value, lower, upper float64) float64 {
+	switch {
+	case value < lower:
+		return lower
+	case value > upper:
+		return upper
+	}
+	return value
+}
@@ -0,0 +1,108 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestBatteryHealthScore(t *testing.T) {
+	now = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name      string
+		separator string
+		variables map[string]string
+		expected  float64
+		ok        bool
+	}{
+		{
+			name: "full input set",
+			variables: map[string]string{
+				"battery.date":            "2018-01-01",
+				"battery.charge":          "90",
+				"battery.packs":           "4",
+				"battery.packs.bad":       "1",
+				"battery.voltage":         "26.4",
+				"battery.voltage.nominal": "24",
+			},
+			// age: 730 days of 5 years -> 60, charge: 90, packs: 75, voltage: 100
+			expected: 60*healthWeightAge + 90*healthWeightCharge + 75*healthWeightPacks + 100*healthWeightVoltage,
+			ok:       true,
+		},
+		{
+			name:      "decimal comma",
+			separator: ",",
+			variables: map[string]string{
+				"battery.date":            "2018-01-01",
+				"battery.charge":          "90,0",
+				"battery.packs":           "4",
+				"battery.packs.bad":       "1",
+				"battery.voltage":         "26,4",
+				"battery.voltage.nominal": "24,0",
+			},
+			expected: 60*healthWeightAge + 90*healthWeightCharge + 75*healthWeightPacks + 100*healthWeightVoltage,
+			ok:       true,
+		},
+		{
+			name: "missing packs",
+			variables: map[string]string{
+				"battery.mfr.date":        "01/01/2018",
+				"battery.charge":          "90",
+				"battery.voltage":         "22.2",
+				"battery.voltage.nominal": "24",
+			},
+			// age: 60, charge: 90, voltage: ratio 0.925 -> 50
+			expected: (60*healthWeightAge + 90*healthWeightCharge + 50*healthWeightVoltage) /
+				(healthWeightAge + healthWeightCharge + healthWeightVoltage),
+			ok: true,
+		},
+		{
+			name: "not enough inputs",
+			variables: map[string]string{
+				"battery.charge":  "90",
+				"battery.voltage": "26.4",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &Upsd{DecimalSeparator: tt.separator, Log: testutil.Logger{}}
+			score, ok := plugin.batteryHealthScore(tt.variables)
+			require.Equal(t, tt.ok, ok)
+			require.InDelta(t, tt.expected, score, 1e-9)
+		})
+	}
+}
+
+func TestUpsdGatherBatteryHealthScore(t *testing.T) {
+	now = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	variables := map[string]string{
+		"battery.date":            "2018-01-01",
+		"battery.charge":          "90",
+		"battery.packs":           "4",
+		"battery.packs.bad":       "1",
+		"battery.voltage":         "26.4",
+		"battery.voltage.nominal": "24",
+		"ups.status":              "OL",
+	}
+
+	var acc testutil.Accumulator
+	plugin := &Upsd{Log: testutil.Logger{}}
+	plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+	require.False(t, acc.HasField("upsd", "battery_health_score"))
+
+	acc.ClearMetrics()
+	plugin.BatteryHealthScore = true
+	plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+	score, ok := acc.FloatField("upsd", "battery_health_score")
+	require.True(t, ok)
+	require.InDelta(t, 78.5, score, 1e-9)
+}
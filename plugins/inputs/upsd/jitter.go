@@ -0,0 +1,46 @@
+package upsd
+
+import (
+	"sort"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+)
+
+// Functions used for delaying the collection, replaced in tests
+var randomDuration = internal.RandomDuration
+var sleep = time.Sleep
+
+// scheduledEndpoint is a server with the delay of its collection relative
+// to the start of the gather.
+type scheduledEndpoint struct {
+	endpoint
+	delay time.Duration
+}
+
+// schedule assigns a random delay within the jitter to each server and
+// orders the servers by their delay.
+func schedule(endpoints []endpoint, jitter time.Duration) []scheduledEndpoint {
+	scheduled := make([]scheduledEndpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		var delay time.Duration
+		if jitter > 0 {
+			delay = randomDuration(jitter)
+		}
+		scheduled = append(scheduled, scheduledEndpoint{endpoint: ep, delay: delay})
+	}
+
+	sort.SliceStable(scheduled, func(i, j int) bool {
+		return scheduled[i].delay < scheduled[j].delay
+	})
+	return scheduled
+}
+
+// waitFor blocks until the delay of the server elapsed since start. The
+// servers are collected one after another, so a server is collected
+// immediately if the previous ones took longer than its delay.
+func waitFor(ep scheduledEndpoint, start time.Time) {
+	if wait := ep.delay - time.Since(start); wait > 0 {
+		sleep(wait)
+	}
+}
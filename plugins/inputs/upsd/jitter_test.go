@@ -0,0 +1,69 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestSchedule(t *testing.T) {
+	endpoints := make([]endpoint, 0, 50)
+	for i := 0; i < 50; i++ {
+		endpoints = append(endpoints, endpoint{host: "127.0.0.1", port: 3493 + i})
+	}
+
+	jitter := 10 * time.Second
+	scheduled := schedule(endpoints, jitter)
+	require.Len(t, scheduled, len(endpoints))
+	for i, ep := range scheduled {
+		require.GreaterOrEqual(t, ep.delay, time.Duration(0))
+		require.Less(t, ep.delay, jitter)
+		if i > 0 {
+			require.GreaterOrEqual(t, ep.delay, scheduled[i-1].delay)
+		}
+	}
+
+	// Without jitter the servers are collected immediately in order
+	scheduled = schedule(endpoints, 0)
+	for i, ep := range scheduled {
+		require.Equal(t, endpoints[i], ep.endpoint)
+		require.Zero(t, ep.delay)
+	}
+}
+
+func TestUpsdGatherJitter(t *testing.T) {
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = time.Sleep }()
+
+	servers := make([]string, 0, 3)
+	for _, name := range []string{"fake1", "fake2", "fake3"} {
+		server := newMockServer()
+		server.addUps(name, map[string]string{"ups.status": "OL"})
+		servers = append(servers, server.listen(t).String())
+	}
+
+	jitter := 30 * time.Second
+	plugin := &Upsd{
+		Servers: servers,
+		Jitter:  config.Duration(jitter),
+		Log:     testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.Len(t, acc.GetTelegrafMetrics(), 2*len(servers)+1)
+
+	// The waits are relative to the start of the gather
+	require.NotEmpty(t, slept)
+	for _, d := range slept {
+		require.Greater(t, d, time.Duration(0))
+		require.LessOrEqual(t, d, jitter)
+	}
+}
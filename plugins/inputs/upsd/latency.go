@@ -0,0 +1,81 @@
+package upsd
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// latencyWindow holds the most recent response times of a server
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{samples: make([]time.Duration, 0, size)}
+}
+
+// add records a response time, replacing the oldest one if the window is
+// full
+func (w *latencyWindow) add(d time.Duration) {
+	if len(w.samples) < cap(w.samples) {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+}
+
+// percentiles returns the given percentiles of the response times in the
+// window using the nearest-rank method
+func (w *latencyWindow) percentiles(ps ...float64) []time.Duration {
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	values := make([]time.Duration, 0, len(ps))
+	for _, p := range ps {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		if rank < 1 {
+			rank = 1
+		}
+		values = append(values, sorted[rank-1])
+	}
+	return values
+}
+
+// observeResponseTime records the response time of a command sent to the
+// given server
+func (u *Upsd) observeResponseTime(address string, d time.Duration) {
+	if u.responseTimes == nil {
+		u.responseTimes = make(map[string]*latencyWindow)
+	}
+	w, ok := u.responseTimes[address]
+	if !ok {
+		w = newLatencyWindow(u.ResponseTimeWindow)
+		u.responseTimes[address] = w
+	}
+	w.add(d)
+}
+
+// gatherResponseTimes emits the upsd_response_time metric with the
+// percentiles of the recent response times of each of the given servers.
+// Servers without any response yet are skipped.
+func (u *Upsd) gatherResponseTimes(acc telegraf.Accumulator, endpoints []endpoint) {
+	for _, ep := range endpoints {
+		w, ok := u.responseTimes[ep.address()]
+		if !ok || len(w.samples) == 0 {
+			continue
+		}
+		values := w.percentiles(50, 95, 99)
+		u.addFields(acc, "upsd_response_time", map[string]interface{}{
+			"samples": len(w.samples),
+			"p50_ns":  values[0].Nanoseconds(),
+			"p95_ns":  values[1].Nanoseconds(),
+			"p99_ns":  values[2].Nanoseconds(),
+		}, map[string]string{"server": ep.address()})
+	}
+}
@@ -0,0 +1,90 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestLatencyWindowPercentiles(t *testing.T) {
+	w := newLatencyWindow(100)
+	// Add the latencies 1ms to 100ms in an arbitrary order
+	for i := 0; i < 100; i++ {
+		w.add(time.Duration((i*37)%100+1) * time.Millisecond)
+	}
+	require.Equal(t, []time.Duration{
+		50 * time.Millisecond,
+		95 * time.Millisecond,
+		99 * time.Millisecond,
+		100 * time.Millisecond,
+	}, w.percentiles(50, 95, 99, 100))
+
+	single := newLatencyWindow(10)
+	single.add(3 * time.Millisecond)
+	require.Equal(t, []time.Duration{3 * time.Millisecond, 3 * time.Millisecond}, single.percentiles(0, 99))
+}
+
+func TestLatencyWindowRolling(t *testing.T) {
+	w := newLatencyWindow(4)
+	for _, ms := range []int{100, 100, 100, 100, 1, 2, 3} {
+		w.add(time.Duration(ms) * time.Millisecond)
+	}
+
+	// The three oldest latencies dropped out of the window
+	require.Len(t, w.samples, 4)
+	require.Equal(t, []time.Duration{
+		2 * time.Millisecond,
+		100 * time.Millisecond,
+	}, w.percentiles(50, 99))
+}
+
+func TestUpsdResponseTimePercentiles(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	server.delays["LIST UPS"] = 20 * time.Millisecond
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:                  addr.IP.String(),
+		Port:                    addr.Port,
+		ResponseTimePercentiles: true,
+		ResponseTimeWindow:      10,
+		Log:                     testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.Equal(t, addr.String(), acc.TagValue("upsd_response_time", "server"))
+
+	// LIST UPS, LIST VAR and LOGOUT are answered, only the first is delayed
+	samples, ok := acc.IntField("upsd_response_time", "samples")
+	require.True(t, ok)
+	require.Equal(t, 3, samples)
+	p50, ok := acc.Int64Field("upsd_response_time", "p50_ns")
+	require.True(t, ok)
+	require.Less(t, p50, (20 * time.Millisecond).Nanoseconds())
+	p99, ok := acc.Int64Field("upsd_response_time", "p99_ns")
+	require.True(t, ok)
+	require.GreaterOrEqual(t, p99, (20 * time.Millisecond).Nanoseconds())
+
+	// The window is limited to the configured size
+	for i := 0; i < 10; i++ {
+		require.NoError(t, plugin.Gather(&acc))
+	}
+	require.Len(t, plugin.responseTimes[addr.String()].samples, 10)
+}
+
+func TestUpsdResponseTimeWindowInvalid(t *testing.T) {
+	plugin := &Upsd{
+		Server:                  defaultAddress,
+		Port:                    defaultPort,
+		ResponseTimePercentiles: true,
+		Log:                     testutil.Logger{},
+	}
+	require.EqualError(t, plugin.Init(), "invalid response_time_window 0")
+}
@@ -0,0 +1,107 @@
+package upsd
+
+import (
+	"math"
+
+	"github.com/influxdata/telegraf"
+)
+
+// mergedMetric collects the upsd metrics of all sources reporting the same
+// serial during a gather.
+type mergedMetric struct {
+	tags    map[string]string
+	fields  map[string]interface{}
+	sums    map[string]float64
+	counts  map[string]int
+	sources int
+
+	// Type of the numeric fields, integer fields stay integers unless any
+	// source reports a float
+	floats map[string]bool
+	ints   map[string]bool
+}
+
+// merge buffers the upsd metric for merging it with the metrics of other
+// sources reporting the same serial. It returns false if the metric cannot
+// be merged, i.e. if it has no serial.
+func (u *Upsd) merge(fields map[string]interface{}, tags map[string]string) bool {
+	serial, ok := tags["serial"]
+	if !ok {
+		return false
+	}
+
+	if u.merged == nil {
+		u.merged = make(map[string]*mergedMetric)
+	}
+	m, found := u.merged[serial]
+	if !found {
+		m = &mergedMetric{
+			tags:   make(map[string]string, len(tags)),
+			fields: make(map[string]interface{}, len(fields)),
+			sums:   make(map[string]float64),
+			counts: make(map[string]int),
+			floats: make(map[string]bool),
+			ints:   make(map[string]bool),
+		}
+		for k, v := range tags {
+			m.tags[k] = v
+		}
+		u.merged[serial] = m
+		u.mergeOrder = append(u.mergeOrder, serial)
+	} else if m.tags["server"] != tags["server"] {
+		// The metric represents multiple servers
+		delete(m.tags, "server")
+	}
+	m.sources++
+
+	for key, value := range fields {
+		var v float64
+		switch value := value.(type) {
+		case int:
+			v = float64(value)
+			m.ints[key] = true
+		case int64:
+			v = float64(value)
+		case float64:
+			v = value
+			m.floats[key] = true
+		default:
+			// Non-numeric fields and the status flags take the first value
+			if _, ok := m.fields[key]; !ok {
+				m.fields[key] = value
+			}
+			continue
+		}
+		m.sums[key] += v
+		m.counts[key]++
+	}
+	return true
+}
+
+// flushMerged emits the merged metrics averaging the numeric fields across
+// all sources. The averages of integer fields are rounded to keep the field
+// types consistent with the metrics of UPSes without a serial.
+func (u *Upsd) flushMerged(acc telegraf.Accumulator) {
+	for _, serial := range u.mergeOrder {
+		m := u.merged[serial]
+		for key, sum := range m.sums {
+			avg := sum / float64(m.counts[key])
+			switch {
+			case m.floats[key]:
+				m.fields[key] = avg
+			case m.ints[key]:
+				m.fields[key] = int(math.Round(avg))
+			default:
+				m.fields[key] = int64(math.Round(avg))
+			}
+		}
+		m.fields["sources"] = m.sources
+		if u.SplitElectrical {
+			u.gatherElectrical(acc, m.fields, m.tags)
+		}
+		acc.AddFields("upsd", m.fields, m.tags, u.timestamps()...)
+		u.emittedMetrics++
+	}
+	u.merged = nil
+	u.mergeOrder = nil
+}
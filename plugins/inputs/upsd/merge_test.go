@@ -0,0 +1,166 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdMergeBySerial(t *testing.T) {
+	first := newMockServer()
+	first.addUps("rack1", map[string]string{
+		"device.model":   "Model A",
+		"device.serial":  "ABC123",
+		"input.voltage":  "230.0",
+		"battery.charge": "100",
+		"ups.status":     "OL",
+	})
+	firstAddr := first.listen(t)
+
+	second := newMockServer()
+	second.addUps("rack1-backup", map[string]string{
+		"device.model":   "Model A (fallback)",
+		"device.serial":  "ABC123",
+		"input.voltage":  "232.0",
+		"battery.charge": "99",
+		"ups.status":     "OL",
+	})
+	second.addUps("other", map[string]string{
+		"device.serial": "XYZ789",
+		"input.voltage": "231",
+		"ups.status":    "OL",
+	})
+	secondAddr := second.listen(t)
+
+	plugin := &Upsd{
+		Servers:       []string{firstAddr.String(), secondAddr.String()},
+		MergeBySerial: true,
+		Log:           testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd",
+			map[string]string{
+				"serial":          "ABC123",
+				"ups_name":        "rack1",
+				"ups_description": "Description of rack1",
+				"model":           "Model A",
+				"status_OL":       "true",
+			},
+			map[string]interface{}{
+				"status_flags":           uint64(8),
+				"status_unknown_tokens":  0,
+				"ups_status":             "OL",
+				"battery_charge_percent": int64(100),
+				"input_voltage":          231.0,
+				"sources":                2,
+			},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd",
+			map[string]string{
+				"serial":          "XYZ789",
+				"ups_name":        "other",
+				"ups_description": "Description of other",
+				"server":          secondAddr.String(),
+				"status_OL":       "true",
+			},
+			map[string]interface{}{
+				"status_flags":          uint64(8),
+				"status_unknown_tokens": 0,
+				"ups_status":            "OL",
+				"input_voltage":         int64(231),
+				"sources":               1,
+			},
+			time.Unix(0, 0),
+		),
+	}
+
+	var actual []telegraf.Metric
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "upsd" {
+			actual = append(actual, m)
+		}
+	}
+	testutil.RequireMetricsEqual(t, expected, actual, testutil.IgnoreTime())
+
+	// The merged metrics are emitted for each gather
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	var count int
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "upsd" {
+			count++
+		}
+	}
+	require.Equal(t, 2, count)
+}
+
+func TestUpsdMergeBySerialSplitElectrical(t *testing.T) {
+	first := newMockServer()
+	first.addUps("rack1", map[string]string{
+		"device.serial":  "ABC123",
+		"input.voltage":  "230.0",
+		"battery.charge": "100",
+		"ups.status":     "OL",
+	})
+	firstAddr := first.listen(t)
+
+	second := newMockServer()
+	second.addUps("rack1-backup", map[string]string{
+		"device.serial":  "ABC123",
+		"input.voltage":  "232.0",
+		"battery.charge": "100",
+		"ups.status":     "OL",
+	})
+	secondAddr := second.listen(t)
+
+	plugin := &Upsd{
+		Servers:         []string{firstAddr.String(), secondAddr.String()},
+		MergeBySerial:   true,
+		SplitElectrical: true,
+		Log:             testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	// The electrical fields are split off after averaging
+	var electrical []telegraf.Metric
+	for _, m := range acc.GetTelegrafMetrics() {
+		switch m.Name() {
+		case "upsd_electrical":
+			electrical = append(electrical, m)
+		case "upsd":
+			require.False(t, m.HasField("input_voltage"))
+		}
+	}
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd_electrical",
+			map[string]string{
+				"serial":          "ABC123",
+				"ups_description": "Description of rack1",
+				"ups_name":        "rack1",
+			},
+			map[string]interface{}{
+				"input_voltage": 231.0,
+			},
+			time.Unix(0, 0),
+		),
+	}, electrical, testutil.IgnoreTime())
+}
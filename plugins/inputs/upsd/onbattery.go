@@ -0,0 +1,129 @@
+package upsd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/choice"
+)
+
+// onBatteryUps is a UPS sampled at the accelerated rate while on battery
+type onBatteryUps struct {
+	ep   endpoint
+	name string
+}
+
+// trackOnBattery records whether the UPS is on battery for the accelerated
+// sampling.
+func (u *Upsd) trackOnBattery(ep endpoint, name string, variables map[string]string) {
+	if u.OnBatteryInterval <= 0 {
+		return
+	}
+
+	key := upsKey(ep, name)
+	if !choice.Contains("OB", strings.Fields(variables["ups.status"])) {
+		delete(u.onBattery, key)
+		return
+	}
+	if u.onBattery == nil {
+		u.onBattery = make(map[string]onBatteryUps)
+	}
+	u.onBattery[key] = onBatteryUps{ep: ep, name: name}
+}
+
+// pruneOnBattery drops the UPSes of the server no longer listed in the
+// given successful gather from the accelerated sampling.
+func (u *Upsd) pruneOnBattery(ep endpoint, upsList map[string]map[string]string, timedOut []string) {
+	for key, ups := range u.onBattery {
+		if ups.ep.address() != ep.address() {
+			continue
+		}
+		if _, found := upsList[ups.name]; !found && !choice.Contains(ups.name, timedOut) {
+			delete(u.onBattery, key)
+		}
+	}
+}
+
+// sampleOnBattery collects the UPSes on battery at the accelerated rate
+// until the plugin is stopped.
+func (u *Upsd) sampleOnBattery(acc telegraf.Accumulator) {
+	defer u.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(u.OnBatteryInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.done:
+			return
+		case <-ticker.C:
+			u.gatherOnBattery(acc)
+		}
+	}
+}
+
+// gatherOnBattery collects the UPSes currently on battery. UPSes back on
+// mains are dropped from the accelerated sampling by gatherUps. Like a
+// regular gather, each sample has its own timestamp and emits its merged
+// metrics right away.
+func (u *Upsd) gatherOnBattery(acc telegraf.Accumulator) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.SnapshotMode && u.snapshotTaken {
+		return
+	}
+	u.gatherTime = now()
+	u.sampling = true
+	defer func() { u.sampling = false }()
+
+	byServer := make(map[string][]onBatteryUps)
+	for _, ups := range u.onBattery {
+		address := ups.ep.address()
+		byServer[address] = append(byServer[address], ups)
+	}
+
+	for address, upsList := range byServer {
+		sort.Slice(upsList, func(i, j int) bool { return upsList[i].name < upsList[j].name })
+		if err := u.gatherOnBatteryServer(acc, upsList); err != nil {
+			acc.AddError(fmt.Errorf("server %s: %w", address, err))
+		}
+	}
+
+	if u.MergeBySerial {
+		u.flushMerged(acc)
+	}
+}
+
+func (u *Upsd) gatherOnBatteryServer(acc telegraf.Accumulator, upsList []onBatteryUps) error {
+	ep := upsList[0].ep
+	c, err := u.connect(ep)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	for _, ups := range upsList {
+		variables, err := u.readVariables(c, ups.name)
+		if err != nil {
+			acc.AddError(fmt.Errorf("server %s: %w", ep.address(), err))
+
+			// UPSes unknown to the server, e.g. removed from its
+			// configuration, would fail on every sample
+			var perr *protocolError
+			if errors.As(err, &perr) && !isRecoverable(err) {
+				delete(u.onBattery, upsKey(ep, ups.name))
+			}
+			continue
+		}
+		u.gatherUps(acc, ep, ups.name, variables)
+	}
+
+	if err := c.logout(); err != nil {
+		u.Log.Debugf("Logout from %s failed: %v", ep.address(), err)
+	}
+	return nil
+}
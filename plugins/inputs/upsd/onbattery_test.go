@@ -0,0 +1,292 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+// upsMetrics returns the upsd metrics of the given UPS collected so far
+func upsMetrics(acc *testutil.Accumulator, name string) []*testutil.Metric {
+	acc.Lock()
+	defer acc.Unlock()
+
+	var metrics []*testutil.Metric
+	for _, m := range acc.Metrics {
+		if m.Measurement == "upsd" && m.Tags["ups_name"] == name {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+func TestUpsdOnBatteryInterval(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{
+		"battery.charge": "80",
+		"ups.status":     "OB DISCHRG",
+	})
+	server.addUps("other", map[string]string{
+		"battery.charge": "100",
+		"ups.status":     "OL",
+	})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:            addr.IP.String(),
+		Port:              addr.Port,
+		OnBatteryInterval: config.Duration(10 * time.Millisecond),
+		Log:               testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	countUps := func(name string) int { return len(upsMetrics(&acc, name)) }
+
+	// Nothing is sampled before the UPS is known to be on battery
+	time.Sleep(50 * time.Millisecond)
+	require.Zero(t, countUps("fake"))
+
+	// The UPS on battery is collected in between the gathers
+	require.NoError(t, plugin.Gather(&acc))
+	require.Eventually(t, func() bool {
+		return countUps("fake") >= 4
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, countUps("other"))
+	require.NoError(t, acc.FirstError())
+
+	// Back on mains the UPS returns to the regular collection
+	server.Lock()
+	server.variables["fake"]["ups.status"] = "OL CHRG"
+	server.Unlock()
+	require.Eventually(t, func() bool {
+		plugin.mu.Lock()
+		defer plugin.mu.Unlock()
+		return len(plugin.onBattery) == 0
+	}, time.Second, 10*time.Millisecond)
+	n := countUps("fake")
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, n, countUps("fake"))
+}
+
+func TestUpsdOnBatteryIntervalUpsRemoved(t *testing.T) {
+	server := newMockServer()
+	server.addUps("a", map[string]string{"ups.status": "OB"})
+	server.addUps("b", map[string]string{"ups.status": "OB"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:            addr.IP.String(),
+		Port:              addr.Port,
+		OnBatteryInterval: config.Duration(10 * time.Millisecond),
+		Log:               testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+	require.NoError(t, plugin.Gather(&acc))
+
+	// The UPS vanishes from the server while on battery
+	server.Lock()
+	server.ups = []string{"b"}
+	delete(server.variables, "a")
+	server.Unlock()
+
+	// The remaining UPS is still sampled while the removed one is dropped
+	// after the first failure
+	n := len(upsMetrics(&acc, "b"))
+	require.Eventually(t, func() bool {
+		return len(upsMetrics(&acc, "b")) >= n+3
+	}, time.Second, 10*time.Millisecond)
+	acc.Lock()
+	require.Len(t, acc.Errors, 1)
+	require.Contains(t, acc.Errors[0].Error(), "UNKNOWN-UPS")
+	acc.Unlock()
+}
+
+func TestUpsdOnBatteryIntervalUpsNotListed(t *testing.T) {
+	server := newMockServer()
+	server.addUps("a", map[string]string{"ups.status": "OB"})
+	server.addUps("b", map[string]string{"ups.status": "OB"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:            addr.IP.String(),
+		Port:              addr.Port,
+		OnBatteryInterval: config.Duration(10 * time.Millisecond),
+		Log:               testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+	require.NoError(t, plugin.Gather(&acc))
+
+	// The server no longer lists the UPS but fails with a recoverable
+	// error when reading it
+	server.Lock()
+	server.ups = []string{"b"}
+	server.responses["LIST VAR a"] = "ERR DATA-STALE\n"
+	server.Unlock()
+	require.Eventually(t, func() bool {
+		acc.Lock()
+		defer acc.Unlock()
+		return len(acc.Errors) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	// The next regular gather drops the UPS from the sampling
+	require.NoError(t, plugin.Gather(&acc))
+	acc.Lock()
+	errs := len(acc.Errors)
+	acc.Unlock()
+	n := len(upsMetrics(&acc, "b"))
+	require.Eventually(t, func() bool {
+		return len(upsMetrics(&acc, "b")) >= n+3
+	}, time.Second, 10*time.Millisecond)
+	acc.Lock()
+	require.Len(t, acc.Errors, errs)
+	acc.Unlock()
+}
+
+func TestUpsdOnBatteryIntervalIncludeInterval(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OB"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:            addr.IP.String(),
+		Port:              addr.Port,
+		OnBatteryInterval: config.Duration(10 * time.Millisecond),
+		IncludeInterval:   true,
+		Log:               testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+	require.NoError(t, plugin.Gather(&acc))
+	time.Sleep(300 * time.Millisecond)
+	require.NoError(t, plugin.Gather(&acc))
+
+	// The samples report their own spacing, not the one of the regular
+	// gathers
+	n := len(upsMetrics(&acc, "fake"))
+	require.Eventually(t, func() bool {
+		return len(upsMetrics(&acc, "fake")) >= n+3
+	}, time.Second, 10*time.Millisecond)
+	metrics := upsMetrics(&acc, "fake")
+	for _, m := range metrics[len(metrics)-2:] {
+		interval, ok := m.Fields["interval_s"].(float64)
+		require.True(t, ok)
+		require.Greater(t, interval, 0.0)
+		require.Less(t, interval, 0.2)
+	}
+}
+
+func TestUpsdOnBatteryIntervalAlignTimestamps(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OB"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:            addr.IP.String(),
+		Port:              addr.Port,
+		OnBatteryInterval: config.Duration(10 * time.Millisecond),
+		AlignTimestamps:   true,
+		Log:               testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	require.NoError(t, plugin.Gather(&acc))
+	require.Eventually(t, func() bool {
+		return len(upsMetrics(&acc, "fake")) >= 3
+	}, time.Second, 10*time.Millisecond)
+
+	// Each sample is stamped with its own time, not the one of the gather
+	seen := make(map[time.Time]bool)
+	for _, m := range upsMetrics(&acc, "fake") {
+		require.False(t, seen[m.Time], "duplicate timestamp %v", m.Time)
+		seen[m.Time] = true
+	}
+}
+
+func TestUpsdOnBatteryIntervalMergeBySerial(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{
+		"battery.charge": "80",
+		"ups.serial":     "ABC123",
+		"ups.status":     "OB",
+	})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:            addr.IP.String(),
+		Port:              addr.Port,
+		OnBatteryInterval: config.Duration(10 * time.Millisecond),
+		MergeBySerial:     true,
+		Log:               testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	// The merged samples are emitted without waiting for the next gather
+	require.NoError(t, plugin.Gather(&acc))
+	require.Eventually(t, func() bool {
+		return len(upsMetrics(&acc, "fake")) >= 3
+	}, time.Second, 10*time.Millisecond)
+	for _, m := range upsMetrics(&acc, "fake") {
+		require.Equal(t, 1, m.Fields["sources"])
+	}
+}
+
+func TestUpsdOnBatteryIntervalSnapshotMode(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OB"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:            addr.IP.String(),
+		Port:              addr.Port,
+		OnBatteryInterval: config.Duration(10 * time.Millisecond),
+		SnapshotMode:      true,
+		Log:               testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	// No samples are collected after the snapshot
+	require.NoError(t, plugin.Gather(&acc))
+	time.Sleep(100 * time.Millisecond)
+	require.Len(t, upsMetrics(&acc, "fake"), 1)
+}
+
+func TestUpsdOnBatteryIntervalGRPC(t *testing.T) {
+	plugin := &Upsd{
+		Backend:           backendGRPC,
+		GRPCEndpoint:      "localhost:50051",
+		OnBatteryInterval: config.Duration(time.Second),
+		Log:               testutil.Logger{},
+	}
+	require.EqualError(t, plugin.Init(), "on_battery_interval is not supported by the grpc backend")
+}
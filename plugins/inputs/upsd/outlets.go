@@ -0,0 +1,58 @@
+package upsd
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/influxdata/telegraf"
+)
+
+var outletVariable = regexp.MustCompile(`^outlet\.(\d+)\.(.+)$`)
+
+// gatherOutlets adds an upsd_outlet metric for each outlet of the UPS
+func (u *Upsd) gatherOutlets(acc telegraf.Accumulator, variables map[string]string, upsTags map[string]string) {
+	outlets := make(map[string]map[string]string)
+	for key, value := range variables {
+		match := outletVariable.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		if outlets[match[1]] == nil {
+			outlets[match[1]] = make(map[string]string)
+		}
+		outlets[match[1]][match[2]] = value
+	}
+
+	ids := make([]string, 0, len(outlets))
+	for id := range outlets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		outlet := outlets[id]
+		fields := make(map[string]interface{})
+		if status, ok := outlet["status"]; ok {
+			fields["status"] = status
+		}
+
+		if raw, ok := outlet["switchable"]; ok {
+			switchable := raw == "yes"
+			fields["switchable"] = switchable
+
+			// Delays are meaningless for outlets that cannot be switched
+			if switchable {
+				u.addNumber(acc, fields, "delay_shutdown", "outlet."+id+".delay.shutdown", variables)
+				u.addNumber(acc, fields, "delay_start", "outlet."+id+".delay.start", variables)
+			}
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		tags := derivedTags(upsTags)
+		tags["outlet"] = id
+		u.addFields(acc, "upsd_outlet", fields, tags)
+	}
+}
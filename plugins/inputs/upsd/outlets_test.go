@@ -0,0 +1,78 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdGatherOutlets(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"device.serial":             "ABC123",
+		"outlet.1.status":           "on",
+		"outlet.1.switchable":       "yes",
+		"outlet.1.delay.shutdown":   "120",
+		"outlet.1.delay.start":      "10",
+		"outlet.2.status":           "on",
+		"outlet.2.switchable":       "no",
+		"outlet.2.delay.shutdown":   "-1",
+		"outlet.2.delay.start":      "-1",
+		"ups.status":                "OL",
+		"outlet.3.desc":             "PowerShare Outlet 3",
+		"outlet.10.status":          "off",
+		"outlet.10.switchable":      "yes",
+		"outlet.10.delay.shutdown":  "0",
+		"outlet.10.delay.start":     "3",
+		"outlet.extra.non.numbered": "ignored",
+	})
+	require.NoError(t, acc.FirstError())
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd_outlet",
+			map[string]string{"ups_name": "fake", "serial": "ABC123", "outlet": "1"},
+			map[string]interface{}{
+				"status":         "on",
+				"switchable":     true,
+				"delay_shutdown": int64(120),
+				"delay_start":    int64(10),
+			},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd_outlet",
+			map[string]string{"ups_name": "fake", "serial": "ABC123", "outlet": "10"},
+			map[string]interface{}{
+				"status":         "off",
+				"switchable":     true,
+				"delay_shutdown": int64(0),
+				"delay_start":    int64(3),
+			},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd_outlet",
+			map[string]string{"ups_name": "fake", "serial": "ABC123", "outlet": "2"},
+			map[string]interface{}{
+				"status":     "on",
+				"switchable": false,
+			},
+			time.Unix(0, 0),
+		),
+	}
+
+	var outlets []telegraf.Metric
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "upsd_outlet" {
+			outlets = append(outlets, m)
+		}
+	}
+	testutil.RequireMetricsEqual(t, expected, outlets, testutil.IgnoreTime())
+}
@@ -0,0 +1,96 @@
+package upsd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Categories of the range validation
+const (
+	rangeVoltage   = "voltage"
+	rangeFrequency = "frequency"
+	rangePercent   = "percent"
+)
+
+// Numeric fields subject to the range validation by category
+var rangeCategories = map[string]string{
+	"battery_voltage":         rangeVoltage,
+	"input_transfer_high":     rangeVoltage,
+	"input_transfer_low":      rangeVoltage,
+	"input_voltage":           rangeVoltage,
+	"nominal_battery_voltage": rangeVoltage,
+	"nominal_input_voltage":   rangeVoltage,
+	"output_voltage":          rangeVoltage,
+	"input_frequency":         rangeFrequency,
+	"battery_charge_percent":  rangePercent,
+	"load_forecast_percent":   rangePercent,
+	"load_percent":            rangePercent,
+}
+
+// valueRange is the inclusive range of sane values of a category
+type valueRange struct {
+	min, max float64
+}
+
+// initRanges validates the configured ranges and collects them by category
+func (u *Upsd) initRanges() error {
+	configured := map[string][]float64{
+		rangeVoltage:   u.VoltageRange,
+		rangeFrequency: u.FrequencyRange,
+		rangePercent:   u.PercentRange,
+	}
+
+	u.ranges = make(map[string]valueRange)
+	for category, bounds := range configured {
+		if len(bounds) == 0 {
+			continue
+		}
+		if len(bounds) != 2 || bounds[0] > bounds[1] {
+			return fmt.Errorf("invalid %s_range %v, expected [min, max]", category, bounds)
+		}
+		u.ranges[category] = valueRange{min: bounds[0], max: bounds[1]}
+	}
+	return nil
+}
+
+// validateRanges flags the numeric fields outside of the configured range
+// of their category with the out_of_range tag listing the affected fields
+// and removes them if requested.
+func (u *Upsd) validateRanges(fields map[string]interface{}, tags map[string]string) {
+	if len(u.ranges) == 0 {
+		return
+	}
+
+	var invalid []string
+	for field, category := range rangeCategories {
+		r, ok := u.ranges[category]
+		if !ok {
+			continue
+		}
+
+		var value float64
+		switch v := fields[field].(type) {
+		case int64:
+			value = float64(v)
+		case float64:
+			value = v
+		default:
+			continue
+		}
+		if value < r.min || value > r.max {
+			invalid = append(invalid, field)
+		}
+	}
+	if len(invalid) == 0 {
+		return
+	}
+
+	sort.Strings(invalid)
+	tags["out_of_range"] = strings.Join(invalid, ",")
+	if u.DropOutOfRange {
+		for _, field := range invalid {
+			delete(fields, field)
+		}
+	}
+}
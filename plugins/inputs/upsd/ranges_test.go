@@ -0,0 +1,60 @@
+package upsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdRangeValidation(t *testing.T) {
+	variables := map[string]string{
+		"battery.charge": "100",
+		"input.voltage":  "65535",
+		"output.voltage": "230",
+		"ups.status":     "OL",
+	}
+
+	plugin := &Upsd{
+		Server:       defaultAddress,
+		Port:         defaultPort,
+		VoltageRange: []float64{0, 500},
+		PercentRange: []float64{0, 100},
+		Log:          testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+	require.NoError(t, acc.FirstError())
+	require.True(t, acc.HasTag("upsd", "out_of_range"))
+	require.Equal(t, "input_voltage", acc.TagValue("upsd", "out_of_range"))
+	voltage, ok := acc.Int64Field("upsd", "input_voltage")
+	require.True(t, ok)
+	require.Equal(t, int64(65535), voltage)
+
+	plugin.DropOutOfRange = true
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+	require.NoError(t, acc.FirstError())
+	require.Equal(t, "input_voltage", acc.TagValue("upsd", "out_of_range"))
+	require.False(t, acc.HasField("upsd", "input_voltage"))
+	require.True(t, acc.HasField("upsd", "output_voltage"))
+
+	plugin = &Upsd{Log: testutil.Logger{}}
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+	require.False(t, acc.HasTag("upsd", "out_of_range"))
+	require.True(t, acc.HasField("upsd", "input_voltage"))
+}
+
+func TestUpsdRangeValidationInvalid(t *testing.T) {
+	plugin := &Upsd{
+		Server:         defaultAddress,
+		Port:           defaultPort,
+		FrequencyRange: []float64{70, 40},
+		Log:            testutil.Logger{},
+	}
+	require.EqualError(t, plugin.Init(), "invalid frequency_range [70 40], expected [min, max]")
+}
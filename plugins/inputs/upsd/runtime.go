@@ -0,0 +1,36 @@
+package upsd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+)
+
+var runtimeVariable = regexp.MustCompile(`^battery\.runtime\.(\d+)$`)
+
+// gatherRuntimes adds an upsd_runtime metric for each runtime estimate
+// given as battery.runtime.N with N being the load point in percent. A
+// single estimate is skipped as it does not allow comparing load points.
+func (u *Upsd) gatherRuntimes(acc telegraf.Accumulator, key, name string, variables map[string]string, upsTags map[string]string) {
+	points := loadPoints(runtimeVariable, variables)
+	if len(points) < 2 {
+		return
+	}
+
+	for _, point := range points {
+		loadPoint := strconv.Itoa(point)
+		variable := "battery.runtime." + loadPoint
+		raw := variables[variable]
+		seconds, err := parseRuntime(raw)
+		if err != nil {
+			acc.AddError(fmt.Errorf("converting %s=%q failed: %w", variable, raw, err))
+			continue
+		}
+
+		tags := derivedTags(upsTags)
+		tags["load_point"] = loadPoint
+		u.addFields(acc, "upsd_runtime", map[string]interface{}{"time_left_ns": u.timeLeft(key, name, variable, seconds)}, tags)
+	}
+}
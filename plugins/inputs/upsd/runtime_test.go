@@ -0,0 +1,64 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdGatherRuntimes(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"device.serial":       "ABC123",
+		"battery.runtime":     "1175",
+		"battery.runtime.low": "300",
+		"battery.runtime.50":  "1800",
+		"battery.runtime.100": "720",
+		"ups.status":          "OL",
+	})
+	require.NoError(t, acc.FirstError())
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd_runtime",
+			map[string]string{"ups_name": "fake", "serial": "ABC123", "load_point": "50"},
+			map[string]interface{}{"time_left_ns": int64(1800 * time.Second)},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd_runtime",
+			map[string]string{"ups_name": "fake", "serial": "ABC123", "load_point": "100"},
+			map[string]interface{}{"time_left_ns": int64(720 * time.Second)},
+			time.Unix(0, 0),
+		),
+	}
+
+	var actual []telegraf.Metric
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "upsd_runtime" {
+			actual = append(actual, m)
+		}
+	}
+	testutil.RequireMetricsEqual(t, expected, actual, testutil.IgnoreTime())
+}
+
+func TestUpsdGatherRuntimesSinglePoint(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	for _, variables := range []map[string]string{
+		{"battery.runtime": "1175", "ups.status": "OL"},
+		{"battery.runtime.50": "1800", "ups.status": "OL"},
+	} {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+		require.NoError(t, acc.FirstError())
+		require.True(t, acc.HasMeasurement("upsd"))
+		require.False(t, acc.HasMeasurement("upsd_runtime"))
+	}
+}
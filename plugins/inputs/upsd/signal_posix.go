@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package upsd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const gatherSignal = syscall.SIGUSR2
+
+func watchForGatherSignal(signals chan os.Signal) error {
+	signal.Notify(signals, gatherSignal)
+	return nil
+}
+
+func stopWatchingGatherSignal(signals chan os.Signal) {
+	signal.Stop(signals)
+}
@@ -0,0 +1,90 @@
+//go:build !windows
+// +build !windows
+
+package upsd
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdGatherOnSignal(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:         addr.IP.String(),
+		Port:           addr.Port,
+		GatherOnSignal: true,
+		Log:            testutil.Logger{},
+	}
+
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	// Scheduled gathers do not collect anything
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, plugin.Gather(&acc))
+	time.Sleep(100 * time.Millisecond)
+	require.Zero(t, acc.NMetrics())
+	server.Lock()
+	require.Empty(t, server.commands)
+	server.Unlock()
+
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, process.Signal(gatherSignal))
+
+	acc.Wait(1)
+	require.NoError(t, acc.FirstError())
+	require.True(t, acc.HasMeasurement("upsd"))
+}
+
+func TestUpsdGatherOnSignalSnapshotMode(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OB"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:            addr.IP.String(),
+		Port:              addr.Port,
+		GatherOnSignal:    true,
+		SnapshotMode:      true,
+		OnBatteryInterval: config.Duration(10 * time.Millisecond),
+		Log:               testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, process.Signal(gatherSignal))
+	acc.Wait(1)
+
+	// The snapshot stops the signal handler and the sampling on battery
+	stopped := make(chan struct{})
+	go func() {
+		plugin.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		require.FailNow(t, "service goroutines still running after the snapshot")
+	}
+	require.NoError(t, acc.FirstError())
+	require.Len(t, upsMetrics(&acc, "fake"), 1)
+}
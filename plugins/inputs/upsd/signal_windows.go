@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package upsd
+
+import (
+	"errors"
+	"os"
+)
+
+func watchForGatherSignal(_ chan os.Signal) error {
+	return errors.New("gather_on_signal is not supported on Windows")
+}
+
+func stopWatchingGatherSignal(_ chan os.Signal) {}
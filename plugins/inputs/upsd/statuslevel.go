@@ -0,0 +1,34 @@
+package upsd
+
+// Default severity of the status tokens for the status_level field ranging
+// from online (0) over charging (1), on battery (2) and low battery (3) to
+// critical (4)
+var defaultStatusLevels = map[string]int{
+	"OL":   0,
+	"CHRG": 1,
+	"OB":   2,
+	"LB":   3,
+	"OVER": 4,
+	"FSD":  4,
+}
+
+// statusLevel returns the highest severity of the active status tokens
+// with the configured levels overriding the default ones. The second
+// return value is false if none of the tokens has a level.
+func (u *Upsd) statusLevel(variables map[string]string) (int, bool) {
+	level, found := 0, false
+	for _, token := range u.statusTokens(variables) {
+		l, ok := u.StatusLevels[token]
+		if !ok {
+			l, ok = defaultStatusLevels[token]
+		}
+		if !ok {
+			continue
+		}
+		if !found || l > level {
+			level = l
+		}
+		found = true
+	}
+	return level, found
+}
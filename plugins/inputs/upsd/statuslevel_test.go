@@ -0,0 +1,50 @@
+package upsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdStatusLevel(t *testing.T) {
+	tests := []struct {
+		status   string
+		levels   map[string]int
+		expected interface{}
+	}{
+		{status: "OL", expected: 0},
+		{status: "OL CHRG", expected: 1},
+		{status: "OB DISCHRG", expected: 2},
+		{status: "OB LB", expected: 3},
+		{status: "OB LB FSD", expected: 4},
+		{status: "OL OVER", expected: 4},
+		{status: "OL BYPASS", levels: map[string]int{"BYPASS": 2}, expected: 2},
+		{status: "OB", levels: map[string]int{"OB": 1}, expected: 1},
+		{status: "TEST"},
+		{status: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			plugin := &Upsd{
+				StatusLevel:  true,
+				StatusLevels: tt.levels,
+				Log:          testutil.Logger{},
+			}
+
+			var acc testutil.Accumulator
+			plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": tt.status})
+			require.NoError(t, acc.FirstError())
+
+			level, ok := acc.IntField("upsd", "status_level")
+			if tt.expected == nil {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.EqualValues(t, tt.expected, level)
+		})
+	}
+}
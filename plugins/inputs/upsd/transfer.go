@@ -0,0 +1,49 @@
+package upsd
+
+import (
+	"strconv"
+	"time"
+)
+
+// Variable reporting the time of the last transfer to or from battery
+const lastTransferVariable = "input.transfer.last"
+
+// Formats used by drivers for the last transfer time, times without zone
+// are taken as UTC
+var lastTransferFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006/01/02 15:04:05",
+	"01/02/2006 15:04:05",
+}
+
+// parseTransferTime parses the last transfer time given as one of the
+// known formats or as Unix timestamp in seconds.
+func parseTransferTime(raw string) (time.Time, bool) {
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(seconds, 0), true
+	}
+	for _, format := range lastTransferFormats {
+		if t, err := time.Parse(format, raw); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// addLastTransfer adds the time of the last transfer as Unix timestamp and
+// the seconds elapsed since then if reported by the UPS.
+func (u *Upsd) addLastTransfer(name string, variables map[string]string, fields map[string]interface{}) {
+	raw, ok := variables[lastTransferVariable]
+	if !ok {
+		return
+	}
+
+	t, ok := parseTransferTime(raw)
+	if !ok {
+		u.Log.Debugf("Parsing %s=%q of %q failed", lastTransferVariable, raw, name)
+		return
+	}
+	fields["last_transfer_time"] = t.Unix()
+	fields["seconds_since_last_transfer"] = now().Sub(t).Seconds()
+}
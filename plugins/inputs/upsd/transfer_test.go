@@ -0,0 +1,53 @@
+package upsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdLastTransfer(t *testing.T) {
+	current := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	transferred := current.Add(-90 * time.Minute)
+	for _, raw := range []string{
+		"2021-06-01T10:30:00Z",
+		"2021-06-01 10:30:00",
+		"2021/06/01 10:30:00",
+		"06/01/2021 10:30:00",
+		"1622543400",
+	} {
+		plugin := &Upsd{Log: testutil.Logger{}}
+
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+			"input.transfer.last": raw,
+			"ups.status":          "OL",
+		})
+		require.NoError(t, acc.FirstError())
+
+		timestamp, ok := acc.Int64Field("upsd", "last_transfer_time")
+		require.True(t, ok, raw)
+		require.Equal(t, transferred.Unix(), timestamp, raw)
+		elapsed, ok := acc.FloatField("upsd", "seconds_since_last_transfer")
+		require.True(t, ok, raw)
+		require.Equal(t, 5400.0, elapsed, raw)
+	}
+
+	plugin := &Upsd{Log: testutil.Logger{}}
+	for _, variables := range []map[string]string{
+		{"ups.status": "OL"},
+		{"input.transfer.last": "never", "ups.status": "OL"},
+	} {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+		require.NoError(t, acc.FirstError())
+		require.False(t, acc.HasField("upsd", "last_transfer_time"))
+		require.False(t, acc.HasField("upsd", "seconds_since_last_transfer"))
+	}
+}
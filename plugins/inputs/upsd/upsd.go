@@ -0,0 +1,1887 @@
+package upsd
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal/choice"
+	tlsint "github.com/influxdata/telegraf/plugins/common/tls"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"google.golang.org/grpc"
+)
+
+// See: https://networkupstools.org/docs/developer-guide.chunked/index.html
+
+const defaultAddress = "127.0.0.1"
+const defaultPort = 3493
+const defaultResponseTimeWindow = 100
+
+var defaultTimeout = config.Duration(5 * time.Second)
+var defaultDiscoveryInterval = config.Duration(5 * time.Minute)
+var defaultCacheMaxAge = config.Duration(10 * time.Minute)
+
+var now = time.Now
+var hostname = os.Hostname
+
+// Source: 1.3.2 at http://rogerprice.org/NUT/ConfigExamples.A5.pdf
+// apcupsd bits:
+// 0	Runtime calibration occurring (Not reported by Smart UPS v/s and BackUPS Pro)
+// 1	SmartTrim (Not reported by 1st and 2nd generation SmartUPS models)
+// 2	SmartBoost
+// 3	On line (this is the normal condition)
+// 4	On battery
+// 5	Overloaded output
+// 6	Battery low
+// 7	Replace battery
+var statusBits = []string{"CAL", "TRIM", "BOOST", "OL", "OB", "OVER", "LB", "RB"}
+
+// Further status tokens defined by NUT without an apcupsd status bit
+var knownStatusTokens = []string{"HB", "CHRG", "DISCHRG", "BYPASS", "OFF", "FSD", "ALARM", "TEST", "COMM", "NOCOMM"}
+
+// Heartbeat tokens emitted by some drivers carrying no status information
+var builtinIgnoredStatusTokens = []string{"TICK", "TOCK"}
+
+// Authentication methods of structured server entries
+const (
+	authNone     = "none"
+	authPassword = "password"
+	authTLS      = "tls"
+)
+
+// Formats of the status fields
+const (
+	statusFormatFlat       = "flat"
+	statusFormatStructured = "structured"
+	statusFormatBoth       = "both"
+)
+
+// Handling of variables with empty values
+const (
+	emptyValuesOmit = "omit"
+	emptyValuesKeep = "keep"
+)
+
+// structuredStatus is the JSON representation of the status emitted with
+// the structured status format
+type structuredStatus struct {
+	Raw    string   `json:"raw"`
+	Flags  uint64   `json:"flags"`
+	Tokens []string `json:"tokens"`
+}
+
+// Variables collected in lightweight mode
+var lightweightVariables = []string{"ups.status", "battery.charge"}
+
+// Mapping of the NUT variables to the tags added if present
+var tagVariables = map[string]string{
+	"driver.parameter.port": "driver_port",
+	"ups.display.language":  "display_language",
+	"ups.id":                "ups_id",
+	"ups.type":              "ups_type",
+	"ups.type.detail":       "ups_type_detail",
+}
+
+// Tags of the upsd metric copied to the derived metrics
+var derivedTagKeys = []string{"ups_name", "server", "serial", "ups_description", "nut_user"}
+
+// Mapping of the NUT variables to the numeric fields emitted if present
+var numericFields = map[string]string{
+	"battery.runtime.low":           "battery_runtime_low",
+	"battery.temperature":           "battery_temp",
+	"battery.voltage":               "battery_voltage",
+	"driver.parameter.pollfreq":     "driver_pollfreq",
+	"driver.parameter.pollinterval": "driver_pollinterval",
+	"input.frequency":               "input_frequency",
+	"input.realpower":               "input_real_power",
+	"input.transfer.high":           "input_transfer_high",
+	"input.transfer.low":            "input_transfer_low",
+	"input.voltage":                 "input_voltage",
+	"ups.temperature":               "internal_temp",
+	"ups.load":                      "load_percent",
+	"ups.load.forecast":             "load_forecast_percent",
+	"ups.load.low":                  "load_low_percent",
+	"battery.voltage.nominal":       "nominal_battery_voltage",
+	"input.voltage.nominal":         "nominal_input_voltage",
+	"ups.realpower.nominal":         "nominal_power",
+	"output.realpower":              "output_real_power",
+	"output.voltage":                "output_voltage",
+	"ups.realpower":                 "real_power",
+}
+
+// Fields moved to the upsd_electrical measurement if splitting
+var electricalFields = []string{
+	"input_frequency",
+	"input_real_power",
+	"input_transfer_high",
+	"input_transfer_low",
+	"input_voltage",
+	"measured_efficiency_percent",
+	"nominal_input_voltage",
+	"nominal_power",
+	"output_real_power",
+	"output_voltage",
+	"output_voltage_error_percent",
+	"power_factor",
+	"real_power",
+}
+
+// Delay variables reporting -1 if the delay is disabled, mapped to the
+// numeric field emitted if enabled and the boolean field reporting the state
+var delayFields = map[string][2]string{
+	"ups.delay.shutdown": {"ups_delay_shutdown", "shutdown_delay_enabled"},
+	"ups.delay.start":    {"ups_delay_start", "start_delay_enabled"},
+}
+
+// Mapping of the NUT variables to the string fields emitted if present
+var stringFields = map[string]string{
+	"battery.charger.status":        "battery_charger_status",
+	"battery.charger.status.reason": "battery_charger_status_reason",
+	"battery.date":                  "battery_date",
+	"battery.mfr.date":              "battery_mfr_date",
+	"battery.rtc.status":            "battery_rtc_status",
+	"battery.status":                "battery_status",
+	"ups.beeper.status":             "beeper_status",
+	"driver.state":                  "driver_state",
+	"ups.firmware":                  "firmware",
+	"ups.firmware.aux":              "firmware_aux",
+	"ups.mfr.date":                  "ups_mfr_date",
+}
+
+// Severity of the battery.status values
+var batteryStatusSeverity = map[string]int{
+	"good":     0,
+	"warning":  1,
+	"critical": 2,
+}
+
+type Upsd struct {
+	Server       string          `toml:"server"`
+	Port         int             `toml:"port"`
+	Servers      []string        `toml:"servers"`
+	ServersFile  string          `toml:"servers_file"`
+	Endpoints    []Endpoint      `toml:"endpoint"`
+	Username     string          `toml:"username"`
+	Password     string          `toml:"password"`
+	TagNutUser   bool            `toml:"tag_nut_user"`
+	Timeout      config.Duration `toml:"timeout"`
+	UpsTimeout   config.Duration `toml:"ups_timeout"`
+	Retries      int             `toml:"retries"`
+	RetryBudget  config.Duration `toml:"retry_budget"`
+	RetryBackoff config.Duration `toml:"retry_backoff"`
+	MaxBackoff   config.Duration `toml:"max_backoff"`
+	Jitter       config.Duration `toml:"jitter"`
+	ForceFloat   bool            `toml:"force_float"`
+
+	MaxTimeLeft           config.Duration `toml:"max_time_left"`
+	RuntimeAlertThreshold config.Duration `toml:"runtime_alert_threshold"`
+	MinLoad               float64         `toml:"min_load"`
+
+	DecimalSeparator string `toml:"decimal_separator"`
+
+	VoltageRange   []float64 `toml:"voltage_range"`
+	FrequencyRange []float64 `toml:"frequency_range"`
+	PercentRange   []float64 `toml:"percent_range"`
+	DropOutOfRange bool      `toml:"drop_out_of_range"`
+
+	SplitElectrical bool `toml:"split_electrical"`
+
+	LightweightMode bool `toml:"lightweight_mode"`
+	SkipOffUPS      bool `toml:"skip_off_ups"`
+
+	IgnoreStatusTokens []string `toml:"ignore_status_tokens"`
+	StatusFormat       string   `toml:"status_format"`
+
+	StatusLevel  bool           `toml:"status_level"`
+	StatusLevels map[string]int `toml:"status_levels"`
+
+	EmptyValues string `toml:"empty_values"`
+
+	TrimSerial      bool `toml:"trim_serial"`
+	UppercaseSerial bool `toml:"uppercase_serial"`
+	MergeBySerial   bool `toml:"merge_by_serial"`
+
+	BatteryHealthScore bool `toml:"battery_health_score"`
+	EmitEvents         bool `toml:"emit_events"`
+	VariablesHash      bool `toml:"variables_hash"`
+
+	SlowCollectInterval config.Duration `toml:"slow_collect_interval"`
+	SlowCacheMaxAge     config.Duration `toml:"slow_cache_max_age"`
+	PrivilegedServers   []string        `toml:"privileged_servers"`
+
+	Discovery         bool            `toml:"discovery"`
+	DiscoveryInterval config.Duration `toml:"discovery_interval"`
+
+	CacheLastKnown bool            `toml:"cache_last_known"`
+	CacheFile      string          `toml:"cache_file"`
+	CacheMaxAge    config.Duration `toml:"cache_max_age"`
+
+	GatherOnSignal bool `toml:"gather_on_signal"`
+	SnapshotMode   bool `toml:"snapshot_mode"`
+
+	OnBatteryInterval config.Duration `toml:"on_battery_interval"`
+
+	EmitConfig   bool `toml:"emit_config"`
+	FleetSummary bool `toml:"fleet_summary"`
+	ErrorCounts  bool `toml:"error_counts"`
+
+	IncludeInterval bool `toml:"include_interval"`
+	AlignTimestamps bool `toml:"align_timestamps"`
+
+	DebugDumpPath    string      `toml:"debug_dump_path"`
+	DebugDumpMaxSize config.Size `toml:"debug_dump_max_size"`
+
+	TraceProtocol bool `toml:"trace_protocol"`
+
+	ResponseTimePercentiles bool `toml:"response_time_percentiles"`
+	ResponseTimeWindow      int  `toml:"response_time_window"`
+
+	TagAgentHost bool   `toml:"tag_agent_host"`
+	AgentHost    string `toml:"agent_host"`
+
+	Backend      string `toml:"backend"`
+	GRPCEndpoint string `toml:"grpc_endpoint"`
+	tlsint.ClientConfig
+
+	Log telegraf.Logger `toml:"-"`
+
+	agentHost       string
+	endpoints       []endpoint
+	ranges          map[string]valueRange
+	privileged      filter.Filter
+	lastSlowCollect map[string]time.Time
+	slowCache       map[string]*slowData
+	states          map[string]*upsState
+	descriptions    map[string]string
+	merged          map[string]*mergedMetric
+	mergeOrder      []string
+
+	// Last-known variables by server address and UPS name
+	cache map[string]map[string]cachedUps
+	stale bool
+
+	mdnsAddress   string
+	discovered    []endpoint
+	lastDiscovery time.Time
+
+	dump io.WriteCloser
+
+	grpcConn *grpc.ClientConn
+
+	configEmitted bool
+	snapshotTaken bool
+
+	lastGather map[string]time.Time
+	lastAuth   map[string]time.Time
+	intervals  map[string]time.Duration
+
+	gatherTime time.Time
+	retrySpent time.Duration
+
+	// Statistics of the current gather for the summary log
+	gatheredUps    int
+	emittedMetrics int
+	fleet          fleetStats
+
+	// Failed gathers since startup by server address
+	errorCounts map[string]*errorCounts
+
+	// Recent response times by server address
+	responseTimes map[string]*latencyWindow
+
+	// UPSes sampled at the accelerated rate by key
+	onBattery map[string]onBatteryUps
+	sampling  bool
+
+	signals chan os.Signal
+	done    chan struct{}
+	stopped bool
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// Endpoint is a NUT server with its own authentication settings
+type Endpoint struct {
+	Address  string `toml:"address"`
+	Auth     string `toml:"auth"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	tlsint.ClientConfig
+}
+
+// endpoint is a NUT server to collect from
+type endpoint struct {
+	host string
+	port int
+	// tagged adds the server address as tag to distinguish the UPSes of
+	// multiple servers
+	tagged bool
+
+	// auth selects the authentication method, the plugin's credentials
+	// are used if empty
+	auth      string
+	username  string
+	password  string
+	tlsConfig *tls.Config
+}
+
+func (ep endpoint) address() string {
+	return net.JoinHostPort(ep.host, strconv.Itoa(ep.port))
+}
+
+// slowData holds the result of the slow collection for a single UPS
+type slowData struct {
+	clients   int
+	commands  int
+	collected time.Time
+}
+
+func (*Upsd) Description() string {
+	return "Monitor UPSes connected via Network UPS Tools"
+}
+
+var sampleConfig = `
+  ## A running NUT server to connect to.
+  # server = "127.0.0.1"
+  # port = 3493
+
+  ## List of NUT servers to connect to as "host:port" or "host" using the
+  ## default port. If set, the server and port settings above are ignored
+  ## and the metrics are tagged with the server address.
+  # servers = []
+
+  ## File listing additional NUT servers, one "host:port" or "host" per
+  ## line. Empty lines and lines starting with "#" are ignored. The file is
+  ## read once on startup and merged with the servers above.
+  # servers_file = ""
+
+  ## Credentials used to authenticate against the server.
+  # username = "user"
+  # password = "password"
+
+  ## Add a nut_user tag with the username used for collecting, e.g. for
+  ## auditing the access in setups with multiple monitoring users. The tag
+  ## is omitted for anonymous access.
+  # tag_nut_user = false
+
+  ## Add an agent_host tag with the hostname of the collecting agent to all
+  ## metrics, e.g. for tracing the collection paths when many agents report
+  ## to one backend. The agent_host setting overrides the hostname of the
+  ## OS, e.g. for containerized agents.
+  # tag_agent_host = false
+  # agent_host = ""
+
+  ## Timeout for connecting to and reading from the server.
+  # timeout = "5s"
+
+  ## Timeout for reading the variables of a single UPS. UPSes not answering
+  ## in time, e.g. due to a hanging driver, are skipped and reported with
+  ## reachable=false while the remaining UPSes of the server are collected
+  ## using a new connection. Set to zero to disable.
+  # ups_timeout = "0s"
+
+  ## Number of retries for connecting to, authenticating against and reading
+  ## from a server. The retry budget limits the total time spent retrying
+  ## across all servers of a gather; once exhausted no further retries are
+  ## made until the next gather. Set the budget to zero for no limit.
+  # retries = 0
+  # retry_budget = "0s"
+
+  ## Delay before the first retry, doubled with each further retry of the
+  ## same server up to the maximum backoff. The delays count towards the
+  ## retry budget and are cut to the remaining budget. Set the maximum to
+  ## zero for no limit.
+  # retry_backoff = "0s"
+  # max_backoff = "0s"
+
+  ## Randomly delay the collection of each server by up to the given
+  ## duration to spread the load when collecting from many servers. The
+  ## servers are still collected one after another, so this should be well
+  ## below the collection interval.
+  # jitter = "0s"
+
+  ## Force parsing numbers as floats
+  ## It is highly recommended to enable this setting to parse numbers
+  ## consistently as floats to avoid database conflicts where some numbers are
+  ## parsed as integers and others as floats.
+  # force_float = false
+
+  ## Maximum time_left_ns reported. Some UPSes report huge runtimes when on
+  ## mains, these are clamped to the maximum with a warning logged once per
+  ## UPS until the runtime is back in range. If zero, the runtime is only
+  ## clamped to avoid overflows.
+  # max_time_left = "0s"
+
+  ## Emit a runtime_below_threshold field being true if the battery runtime
+  ## drops below the given threshold, independent of the battery.runtime.low
+  ## threshold of the device. Set to zero to disable.
+  # runtime_alert_threshold = "0s"
+
+  ## Emit an underloaded field being true if the load drops below the given
+  ## percentage, e.g. hinting at a disconnected downstream. If zero, the
+  ## ups.load.low threshold of the device is used if reported.
+  # min_load = 0.0
+
+  ## Decimal separator used by the drivers, e.g. "," for drivers reporting
+  ## numbers like "230,5". The numbers are normalized before parsing.
+  # decimal_separator = "."
+
+  ## Sane physical ranges of the numeric fields as [min, max] per category.
+  ## Fields outside of their range, e.g. due to corrupted driver reads, are
+  ## listed in the out_of_range tag and dropped if drop_out_of_range is set.
+  ## Categories without a range are not validated.
+  # voltage_range = [0.0, 500.0]
+  # frequency_range = [40.0, 70.0]
+  # percent_range = [0.0, 100.0]
+  # drop_out_of_range = false
+
+  ## Move the voltage, power and frequency fields of the UPS into a separate
+  ## upsd_electrical measurement, e.g. for storing them with a dedicated
+  ## retention policy. Status and battery fields stay in upsd.
+  # split_electrical = false
+
+  ## Only collect ups.status and battery.charge of each UPS, skipping all
+  ## other variables and derived values. This minimizes the load on the
+  ## server and the storage for very large fleets.
+  # lightweight_mode = false
+
+  ## Skip all metrics of UPSes reporting the "OFF" status, i.e. UPSes
+  ## intentionally turned off. The upsd_servers metric is still emitted.
+  # skip_off_ups = false
+
+  ## Additional ups.status tokens to ignore. Ignored tokens do not create
+  ## tags and are not counted as unknown. The heartbeat tokens "TICK" and
+  ## "TOCK" are always ignored.
+  # ignore_status_tokens = []
+
+  ## Format of the status fields. "flat" emits the status_flags,
+  ## status_unknown_tokens and ups_status fields, "structured" emits a
+  ## single JSON encoded status field containing the raw status, the status
+  ## flags and the active tokens, and "both" emits all of them.
+  # status_format = "flat"
+
+  ## Emit a status_level field with the highest severity of the active
+  ## status tokens, by default 0 for online ("OL"), 1 for charging ("CHRG"),
+  ## 2 for on battery ("OB"), 3 for low battery ("LB") and 4 for critical
+  ## states ("OVER", "FSD"). The field is omitted if no token has a level.
+  ## The levels can be overridden or extended in the status_levels table
+  ## below.
+  # status_level = false
+
+  ## Handling of variables reported with an empty value by the driver,
+  ## either "omit" to skip them or "keep" to emit them as empty fields.
+  ## Status variables, i.e. ups.status and all variables ending in
+  ## ".status", are always kept.
+  # empty_values = "omit"
+
+  ## Normalize the serial tag as some drivers pad the serial with whitespace
+  ## or vary the case, producing different tags for the same device.
+  # trim_serial = true
+  # uppercase_serial = false
+
+  ## Merge the upsd metrics of all UPSes reporting the same serial, e.g.
+  ## when monitoring a UPS via redundant servers. Numeric fields are
+  ## averaged across the sources, rounding the average of integer fields,
+  ## all others take the first value. The upsd_outlet, upsd_efficiency and
+  ## upsd_runtime metrics are not merged.
+  # merge_by_serial = false
+
+  ## Emit a derived battery_health_score between 0 (bad) and 100 (good)
+  ## combining the battery age, charge, ratio of bad battery packs and the
+  ## battery voltage relative to its nominal value. See the README for
+  ## the weights of the individual inputs.
+  # battery_health_score = false
+
+  ## Emit a one-shot upsd_event metric whenever a UPS transitions to battery
+  ## ("on_battery"), back to mains ("back_online") or to low battery
+  ## ("low_battery").
+  # emit_events = false
+
+  ## Emit a variables_hash field with a hash over all variables of the UPS,
+  ## allowing to detect any change by watching a single field.
+  # variables_hash = false
+
+  ## Interval for collecting the number of clients and instant commands of
+  ## each UPS. These change rarely, so they are collected less often than
+  ## the variables and cached in between. Set to zero to disable.
+  # slow_collect_interval = "0s"
+
+  ## Maximum age of the cached slow-collection results. If the slow
+  ## collection keeps failing, cached values older than this are dropped
+  ## and the fields are omitted. Set to zero to keep them indefinitely.
+  # slow_cache_max_age = "0s"
+
+  ## Servers as "host:port" to run the slow collection on, as listing the
+  ## clients and instant commands requires privileges not granted by all
+  ## servers. Glob patterns are supported. If empty, all servers are used.
+  # privileged_servers = []
+
+  ## Discover NUT servers advertising the "_nut._tcp" service via mDNS and
+  ## collect from each of them in addition to the configured servers.
+  ## Discovered servers already configured are only collected once. Set
+  ## server to an empty string to only collect from discovered servers.
+  # discovery = false
+
+  ## Interval for refreshing the list of discovered servers.
+  # discovery_interval = "5m"
+
+  ## Persist the last successfully collected variables of each UPS to the
+  ## cache file. If a server cannot be collected, the cached values not
+  ## older than the maximum age are emitted tagged with stale=true to avoid
+  ## gaps in dashboards. The error is reported nevertheless.
+  # cache_last_known = false
+  # cache_file = "/var/lib/telegraf/upsd_cache.json"
+  # cache_max_age = "10m"
+
+  ## Skip the scheduled gathers and only collect when the process receives
+  ## a SIGUSR2 signal. This reduces the polling of slow drivers for
+  ## event-driven setups. Not supported on Windows.
+  # gather_on_signal = false
+
+  ## Additionally collect UPSes on battery at the given interval, e.g. for
+  ## catching a rapidly declining charge, independent of the collection
+  ## interval. A UPS returns to the regular collection once it reports to be
+  ## back on mains. Set to zero to disable.
+  # on_battery_interval = "0s"
+
+  ## Collect exactly once and stop collecting afterwards, including the
+  ## signal-triggered collection and the sampling on battery, e.g. for
+  ## scripted captures. The plugin cannot terminate Telegraf, so run it with
+  ## --once to exit after the snapshot has been written.
+  # snapshot_mode = false
+
+  ## Emit a upsd_config metric with the effective settings once after
+  ## startup, e.g. for auditing the configuration across agents.
+  # emit_config = false
+
+  ## Emit a upsd_fleet metric on each gather with the minimum battery charge,
+  ## the minimum runtime and the number of UPSes on battery across all
+  ## servers, e.g. for a single pane of glass.
+  # fleet_summary = false
+
+  ## Emit a upsd_errors metric on each gather with the number of failed
+  ## gathers of each server since startup, classified into recoverable
+  ## errors, e.g. network issues, and fatal errors, e.g. denied access.
+  # error_counts = false
+
+  ## Add an interval_s field with the time in seconds since the previous
+  ## collection from the same server, e.g. for downstream rate calculations.
+  ## Samples collected on battery report the time since the previous
+  ## collection of the UPS. The field is omitted on the first collection.
+  # include_interval = false
+
+  ## Stamp all metrics of a gather with the time the gather started instead
+  ## of the time of their collection, aligning the metrics of all servers.
+  # align_timestamps = false
+
+  ## Append the variables of all UPSes to the given file as JSON lines on
+  ## each gather, e.g. for reproducing driver quirks in bug reports. The
+  ## file is rotated when exceeding the maximum size and on shutdown,
+  ## keeping one archive.
+  # debug_dump_path = ""
+  # debug_dump_max_size = "10MB"
+
+  ## Log every command sent to and line received from the NUT servers at
+  ## debug level for protocol-level bug reports. Passwords are redacted.
+  # trace_protocol = false
+
+  ## Emit a upsd_response_time metric on each gather with the 50th, 95th and
+  ## 99th percentile of the response times of the NUT servers over the most
+  ## recent commands, e.g. for spotting servers with a slow tail. The window
+  ## sets the number of commands per server kept.
+  # response_time_percentiles = false
+  # response_time_window = 100
+
+  ## Backend for collecting the variables, either "nut" connecting to the
+  ## NUT servers above or "grpc" collecting from a gRPC gateway proxying
+  ## NUT at the given "host:port". The TLS settings only apply to the gRPC
+  ## backend, without them the connection is unencrypted.
+  # backend = "nut"
+  # grpc_endpoint = ""
+  # tls_ca = "/etc/telegraf/ca.pem"
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  # insecure_skip_verify = false
+
+  ## Severity of the status tokens for the status_level field overriding
+  ## or extending the default levels.
+  # [inputs.upsd.status_levels]
+  #   BYPASS = 2
+  #   RB = 1
+
+  ## Servers with individual authentication settings. The auth method is
+  ## either "none", "password" using the given username and password or
+  ## "tls" using STARTTLS with the given client certificate and no password.
+  ## It defaults to "password" if a username is given or "none" otherwise.
+  # [[inputs.upsd.endpoint]]
+  #   address = "nut1.example.com:3493"
+  #   auth = "password"
+  #   username = "user"
+  #   password = "password"
+  # [[inputs.upsd.endpoint]]
+  #   address = "nut2.example.com:3493"
+  #   auth = "tls"
+  #   tls_ca = "/etc/telegraf/ca.pem"
+  #   tls_cert = "/etc/telegraf/cert.pem"
+  #   tls_key = "/etc/telegraf/key.pem"
+`
+
+func (*Upsd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (u *Upsd) Init() error {
+	servers := u.Servers
+	if u.ServersFile != "" {
+		fileServers, err := readServersFile(u.ServersFile)
+		if err != nil {
+			return fmt.Errorf("reading servers_file failed: %w", err)
+		}
+		servers = append(append([]string{}, servers...), fileServers...)
+	}
+
+	u.endpoints = nil
+	if len(servers) == 0 && u.Server != "" {
+		u.endpoints = append(u.endpoints, endpoint{host: u.Server, port: u.Port})
+	}
+	seen := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		ep, err := parseEndpoint(server)
+		if err != nil {
+			return fmt.Errorf("invalid server %q: %w", server, err)
+		}
+		if seen[ep.address()] {
+			continue
+		}
+		seen[ep.address()] = true
+		u.endpoints = append(u.endpoints, ep)
+	}
+	for _, cfg := range u.Endpoints {
+		ep, err := newEndpoint(cfg)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint %q: %w", cfg.Address, err)
+		}
+		u.endpoints = append(u.endpoints, ep)
+	}
+
+	switch u.StatusFormat {
+	case "":
+		u.StatusFormat = statusFormatFlat
+	case statusFormatFlat, statusFormatStructured, statusFormatBoth:
+	default:
+		return fmt.Errorf("invalid status_format %q", u.StatusFormat)
+	}
+
+	switch u.EmptyValues {
+	case "":
+		u.EmptyValues = emptyValuesOmit
+	case emptyValuesOmit, emptyValuesKeep:
+	default:
+		return fmt.Errorf("invalid empty_values %q", u.EmptyValues)
+	}
+
+	if len([]rune(u.DecimalSeparator)) > 1 {
+		return fmt.Errorf("invalid decimal_separator %q", u.DecimalSeparator)
+	}
+
+	if err := u.initRanges(); err != nil {
+		return err
+	}
+
+	privileged, err := filter.Compile(u.PrivilegedServers)
+	if err != nil {
+		return fmt.Errorf("invalid privileged_servers: %w", err)
+	}
+	u.privileged = privileged
+
+	switch u.Backend {
+	case "", backendNUT:
+		u.Backend = backendNUT
+	case backendGRPC:
+		if u.GRPCEndpoint == "" {
+			return errors.New("grpc_endpoint required for the grpc backend")
+		}
+		if u.Discovery {
+			return errors.New("discovery is not supported by the grpc backend")
+		}
+		if u.OnBatteryInterval > 0 {
+			return errors.New("on_battery_interval is not supported by the grpc backend")
+		}
+		ep, err := parseEndpoint(u.GRPCEndpoint)
+		if err != nil {
+			return fmt.Errorf("invalid grpc_endpoint %q: %w", u.GRPCEndpoint, err)
+		}
+		u.endpoints = []endpoint{ep}
+	default:
+		return fmt.Errorf("invalid backend %q", u.Backend)
+	}
+
+	if u.TagAgentHost {
+		u.agentHost = u.AgentHost
+		if u.agentHost == "" {
+			name, err := hostname()
+			if err != nil {
+				return fmt.Errorf("determining hostname failed: %w", err)
+			}
+			u.agentHost = name
+		}
+	}
+
+	if u.ResponseTimePercentiles && u.ResponseTimeWindow < 1 {
+		return fmt.Errorf("invalid response_time_window %d", u.ResponseTimeWindow)
+	}
+
+	if u.CacheLastKnown {
+		if u.CacheFile == "" {
+			return errors.New("cache_file required for caching the last-known values")
+		}
+		if err := u.loadCache(); err != nil {
+			return fmt.Errorf("reading cache_file failed: %w", err)
+		}
+	}
+
+	if len(u.endpoints) == 0 && !u.Discovery {
+		return errors.New("no server configured")
+	}
+	return nil
+}
+
+func newEndpoint(cfg Endpoint) (endpoint, error) {
+	ep, err := parseEndpoint(cfg.Address)
+	if err != nil {
+		return endpoint{}, err
+	}
+
+	ep.auth = cfg.Auth
+	if ep.auth == "" {
+		ep.auth = authNone
+		if cfg.Username != "" {
+			ep.auth = authPassword
+		}
+	}
+
+	switch ep.auth {
+	case authNone:
+	case authPassword:
+		if cfg.Username == "" || cfg.Password == "" {
+			return endpoint{}, errors.New("username and password required for password authentication")
+		}
+		ep.username, ep.password = cfg.Username, cfg.Password
+	case authTLS:
+		tlsConfig, err := cfg.ClientConfig.TLSConfig()
+		if err != nil {
+			return endpoint{}, err
+		}
+		if tlsConfig == nil || len(tlsConfig.Certificates) == 0 {
+			return endpoint{}, errors.New("tls_cert and tls_key required for tls authentication")
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = ep.host
+		}
+		ep.tlsConfig = tlsConfig
+	default:
+		return endpoint{}, fmt.Errorf("unknown auth method %q", ep.auth)
+	}
+	return ep, nil
+}
+
+// readServersFile reads the server entries from the given file skipping
+// empty lines and comments.
+func readServersFile(path string) ([]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		servers = append(servers, line)
+	}
+	return servers, nil
+}
+
+// parseEndpoint parses a "host:port" or "host" server entry
+func parseEndpoint(server string) (endpoint, error) {
+	host, portStr, err := net.SplitHostPort(server)
+	if err != nil {
+		// No port given
+		if strings.Contains(err.Error(), "missing port") {
+			return endpoint{host: server, port: defaultPort, tagged: true}, nil
+		}
+		return endpoint{}, err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("invalid port: %w", err)
+	}
+	return endpoint{host: host, port: port, tagged: true}, nil
+}
+
+func (u *Upsd) Start(acc telegraf.Accumulator) error {
+	u.done = make(chan struct{})
+	u.stopped = false
+	if u.OnBatteryInterval > 0 {
+		u.wg.Add(1)
+		go u.sampleOnBattery(acc)
+	}
+
+	if !u.GatherOnSignal {
+		return nil
+	}
+
+	u.signals = make(chan os.Signal, 1)
+	if err := watchForGatherSignal(u.signals); err != nil {
+		return err
+	}
+
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		for {
+			select {
+			case <-u.done:
+				return
+			case <-u.signals:
+				if err := u.gather(acc); err != nil {
+					acc.AddError(err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (u *Upsd) Stop() {
+	defer u.closeDebugDump()
+	defer u.closeGRPC()
+	if u.done == nil {
+		return
+	}
+	u.mu.Lock()
+	u.stopService()
+	u.mu.Unlock()
+	u.wg.Wait()
+	u.done = nil
+}
+
+// stopService stops the signal handler and the sampling on battery without
+// waiting for them to exit, as the caller might be running on one of them.
+// It must be called with the mutex held.
+func (u *Upsd) stopService() {
+	if u.done == nil || u.stopped {
+		return
+	}
+	if u.signals != nil {
+		stopWatchingGatherSignal(u.signals)
+	}
+	close(u.done)
+	u.stopped = true
+}
+
+func (u *Upsd) Gather(acc telegraf.Accumulator) error {
+	// Collection is triggered by the signal handler started in Start
+	if u.GatherOnSignal {
+		return nil
+	}
+	return u.gather(acc)
+}
+
+func (u *Upsd) gather(acc telegraf.Accumulator) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.SnapshotMode && u.snapshotTaken {
+		return nil
+	}
+
+	start := time.Now()
+	u.gatherTime = now()
+	u.gatheredUps, u.emittedMetrics = 0, 0
+	u.fleet = fleetStats{}
+	u.retrySpent = 0
+
+	if u.EmitConfig && !u.configEmitted {
+		u.gatherConfig(acc)
+		u.configEmitted = true
+	}
+
+	endpoints := u.endpoints
+	if u.Discovery {
+		u.refreshDiscovery(acc)
+		endpoints = mergeDiscovered(endpoints, u.discovered)
+	}
+
+	var reachable int
+	for _, scheduled := range schedule(endpoints, time.Duration(u.Jitter)) {
+		waitFor(scheduled, start)
+
+		ep := scheduled.endpoint
+		if err := u.gatherServer(acc, ep); err != nil {
+			acc.AddError(fmt.Errorf("server %s: %w", ep.address(), err))
+			if u.ErrorCounts {
+				u.countError(ep, err)
+			}
+			continue
+		}
+		reachable++
+	}
+
+	if u.MergeBySerial {
+		u.flushMerged(acc)
+	}
+	if u.FleetSummary {
+		u.gatherFleet(acc)
+	}
+	if u.ErrorCounts {
+		u.gatherErrors(acc, endpoints)
+	}
+	if u.ResponseTimePercentiles {
+		u.gatherResponseTimes(acc, endpoints)
+	}
+
+	if len(endpoints) > 0 {
+		u.addFields(acc, "upsd_servers", map[string]interface{}{
+			"configured":      len(endpoints),
+			"reachable":       reachable,
+			"reachable_ratio": float64(reachable) / float64(len(endpoints)),
+		}, nil)
+	}
+
+	u.Log.Debugf("Gather summary: servers=%d reachable=%d ups=%d metrics=%d duration=%s",
+		len(endpoints), reachable, u.gatheredUps, u.emittedMetrics, time.Since(start))
+
+	if u.SnapshotMode {
+		u.snapshotTaken = true
+		u.stopService()
+		u.Log.Infof("Snapshot of %d UPSes collected, stopped collecting", u.gatheredUps)
+	}
+	return nil
+}
+
+// updateInterval records the time elapsed since the previous collection
+// from the given server.
+func (u *Upsd) updateInterval(address string) {
+	if u.lastGather == nil {
+		u.lastGather = make(map[string]time.Time)
+		u.intervals = make(map[string]time.Duration)
+	}
+
+	current := now()
+	if last, ok := u.lastGather[address]; ok {
+		u.intervals[address] = current.Sub(last)
+	}
+	u.lastGather[address] = current
+}
+
+// collectionInterval returns the time elapsed since the previous collection
+// from the server of the UPS. Accelerated samples on battery report the time
+// since the previous collection of the UPS itself instead.
+func (u *Upsd) collectionInterval(key string, ep endpoint) (time.Duration, bool) {
+	if u.stale {
+		interval, ok := u.intervals[ep.address()]
+		return interval, ok
+	}
+
+	current := now()
+	s, _ := u.state(key)
+	last := s.collected
+	s.collected = current
+	if u.sampling {
+		return current.Sub(last), !last.IsZero()
+	}
+	interval, ok := u.intervals[ep.address()]
+	return interval, ok
+}
+
+// isPrivileged checks if the slow collection should run on the server
+func (u *Upsd) isPrivileged(ep endpoint) bool {
+	return u.privileged == nil || u.privileged.Match(ep.address())
+}
+
+// gatherConfig emits the effective settings relevant for auditing
+func (u *Upsd) gatherConfig(acc telegraf.Accumulator) {
+	format := "auto"
+	if u.ForceFloat {
+		format = "float"
+	}
+
+	var modes []string
+	var tlsEnabled bool
+	for _, ep := range u.endpoints {
+		mode := ep.auth
+		if mode == "" {
+			mode = authNone
+			if u.Username != "" && u.Password != "" {
+				mode = authPassword
+			}
+		}
+		if !choice.Contains(mode, modes) {
+			modes = append(modes, mode)
+		}
+		tlsEnabled = tlsEnabled || ep.auth == authTLS
+	}
+	sort.Strings(modes)
+
+	tags := map[string]string{
+		"format":               format,
+		"ignore_status_tokens": strconv.Itoa(len(u.IgnoreStatusTokens)),
+		"tls":                  strconv.FormatBool(tlsEnabled),
+		"auth":                 strings.Join(modes, ","),
+		"lightweight_mode":     strconv.FormatBool(u.LightweightMode),
+		"discovery":            strconv.FormatBool(u.Discovery),
+	}
+	u.addFields(acc, "upsd_config", map[string]interface{}{"servers": len(u.endpoints)}, tags)
+}
+
+func (u *Upsd) gatherServer(acc telegraf.Accumulator, ep endpoint) error {
+	upsList, timedOut, err := u.fetchWithRetries(ep)
+	if err != nil {
+		if u.CacheLastKnown {
+			u.gatherCached(acc, ep)
+		}
+		u.addServerFields(acc, ep, map[string]interface{}{})
+		return err
+	}
+	if u.CacheLastKnown {
+		if err := u.updateCache(ep, upsList, timedOut); err != nil {
+			acc.AddError(fmt.Errorf("updating cache failed: %w", err))
+		}
+	}
+	for _, name := range timedOut {
+		u.gatherUnreachable(acc, ep, name)
+	}
+	u.pruneOnBattery(ep, upsList, timedOut)
+
+	if u.DebugDumpPath != "" {
+		if err := u.writeDebugDump(ep, upsList); err != nil {
+			acc.AddError(fmt.Errorf("debug dump: %w", err))
+		}
+	}
+
+	address := ep.address()
+	if u.IncludeInterval {
+		u.updateInterval(address)
+	}
+
+	if u.SlowCollectInterval > 0 && !u.LightweightMode && u.Backend != backendGRPC && u.isPrivileged(ep) && now().Sub(u.lastSlowCollect[address]) >= time.Duration(u.SlowCollectInterval) {
+		if err := u.fetchSlow(ep, upsList); err != nil {
+			acc.AddError(fmt.Errorf("slow collection: %w", err))
+		} else {
+			if u.lastSlowCollect == nil {
+				u.lastSlowCollect = make(map[string]time.Time)
+			}
+			u.lastSlowCollect[address] = now()
+		}
+	}
+
+	models := make(map[string]bool)
+	for name, variables := range upsList {
+		u.gatherUps(acc, ep, name, variables)
+		if model := firstOf(variables, "device.model", "ups.model"); model != "" {
+			models[model] = true
+		}
+	}
+	u.gatheredUps += len(upsList)
+
+	// Unexpected hardware diversity can hint at misconfigured inventories
+	fields := make(map[string]interface{})
+	if !u.LightweightMode {
+		fields["distinct_models"] = len(models)
+	}
+	u.addServerFields(acc, ep, fields)
+	return nil
+}
+
+// addServerFields emits the upsd_server metric with the given fields and
+// the time since the last successful authentication against the server.
+// The metric is skipped if there are no fields.
+func (u *Upsd) addServerFields(acc telegraf.Accumulator, ep endpoint, fields map[string]interface{}) {
+	if last, ok := u.lastAuth[ep.address()]; ok {
+		fields["seconds_since_auth"] = now().Sub(last).Seconds()
+	}
+	if len(fields) == 0 {
+		return
+	}
+	u.addFields(acc, "upsd_server", fields, map[string]string{"server": ep.address()})
+}
+
+// gatherUnreachable reports a UPS not answering within the per-UPS timeout
+func (u *Upsd) gatherUnreachable(acc telegraf.Accumulator, ep endpoint, name string) {
+	tags := map[string]string{
+		"ups_name": name,
+	}
+	if ep.tagged {
+		tags["server"] = ep.address()
+	}
+	if description, ok := u.descriptions[upsKey(ep, name)]; ok {
+		tags["ups_description"] = description
+	}
+	if user := u.nutUser(ep); user != "" && u.TagNutUser {
+		tags["nut_user"] = user
+	}
+	u.addFields(acc, "upsd", map[string]interface{}{"reachable": false}, tags)
+}
+
+func (u *Upsd) gatherUps(acc telegraf.Accumulator, ep endpoint, name string, variables map[string]string) {
+	if u.SkipOffUPS && choice.Contains("OFF", strings.Fields(variables["ups.status"])) {
+		u.Log.Debugf("Skipping UPS %q of %s being turned off", name, ep.address())
+		return
+	}
+	if u.EmptyValues != emptyValuesKeep {
+		variables = omitEmptyValues(variables)
+	}
+
+	tags := map[string]string{
+		"ups_name": name,
+	}
+	if ep.tagged {
+		tags["server"] = ep.address()
+	}
+	if serial := u.normalizeSerial(firstOf(variables, "device.serial", "ups.serial")); serial != "" {
+		tags["serial"] = serial
+	}
+	if model := firstOf(variables, "device.model", "ups.model"); model != "" {
+		tags["model"] = model
+	}
+	for key, tag := range tagVariables {
+		if v := variables[key]; v != "" {
+			tags[tag] = v
+		}
+	}
+	if description, ok := u.descriptions[upsKey(ep, name)]; ok {
+		tags["ups_description"] = description
+	}
+	if user := u.nutUser(ep); user != "" && u.TagNutUser {
+		tags["nut_user"] = user
+	}
+
+	status, unknown := u.mapStatus(variables, tags)
+	fields := make(map[string]interface{})
+	if u.StatusFormat != statusFormatStructured {
+		fields["status_flags"] = status
+		fields["status_unknown_tokens"] = unknown
+		fields["ups_status"] = variables["ups.status"]
+	}
+	if u.StatusFormat == statusFormatStructured || u.StatusFormat == statusFormatBoth {
+		structured, err := json.Marshal(structuredStatus{
+			Raw:    variables["ups.status"],
+			Flags:  status,
+			Tokens: u.statusTokens(variables),
+		})
+		if err != nil {
+			acc.AddError(fmt.Errorf("encoding status failed: %w", err))
+		} else {
+			fields["status"] = string(structured)
+		}
+	}
+
+	if u.UpsTimeout > 0 && !u.stale {
+		fields["reachable"] = true
+	}
+
+	if u.StatusLevel && !u.LightweightMode {
+		if level, ok := u.statusLevel(variables); ok {
+			fields["status_level"] = level
+		}
+	}
+
+	if u.LightweightMode {
+		u.addNumber(acc, fields, "battery_charge_percent", "battery.charge", variables)
+		u.validateRanges(fields, tags)
+		if !u.stale {
+			u.fleet.add(variables["ups.status"], fields)
+		}
+		u.addFields(acc, "upsd", fields, tags)
+		return
+	}
+
+	// Cached variables must not update the per-UPS state, otherwise the
+	// derivations would compare fresh values against stale ones
+	key := upsKey(ep, name)
+	if !u.stale {
+		u.trackOnBattery(ep, name, variables)
+		if u.EmitEvents {
+			u.emitEvents(acc, key, variables, tags)
+		}
+		u.addBeeperChange(key, variables, fields)
+		u.addDataAdvanced(key, variables, fields)
+		u.addChargeRate(key, variables, fields)
+		u.addStatusChange(key, status, fields)
+	}
+	if u.VariablesHash {
+		fields["variables_hash"] = fmt.Sprintf("%016x", hashVariables(variables))
+	}
+
+	if raw, ok := variables["battery.runtime"]; ok {
+		timeLeftS, err := parseRuntime(raw)
+		if err != nil {
+			acc.AddError(fmt.Errorf("converting battery.runtime=%q failed: %w", raw, err))
+		} else {
+			// Compatibility with apcupsd metrics format
+			fields["time_left_ns"] = u.timeLeft(key, name, "battery.runtime", timeLeftS)
+
+			if u.RuntimeAlertThreshold > 0 {
+				threshold := time.Duration(u.RuntimeAlertThreshold)
+				fields["runtime_below_threshold"] = timeLeftS < int64(threshold/time.Second)
+			}
+		}
+	}
+
+	for key, field := range numericFields {
+		u.addNumber(acc, fields, field, key, variables)
+	}
+
+	if underloaded, ok := u.underloaded(variables); ok {
+		fields["underloaded"] = underloaded
+	}
+
+	for key, names := range delayFields {
+		raw, ok := variables[key]
+		if !ok {
+			continue
+		}
+		if raw == "-1" {
+			fields[names[1]] = false
+			continue
+		}
+		fields[names[1]] = true
+		u.addNumber(acc, fields, names[0], key, variables)
+	}
+
+	// Some devices only provide an approximate charge value
+	if _, ok := variables["battery.charge"]; ok {
+		u.addNumber(acc, fields, "battery_charge_percent", "battery.charge", variables)
+	} else if _, ok := variables["battery.charge.approx"]; ok {
+		u.addNumber(acc, fields, "battery_charge_percent", "battery.charge.approx", variables)
+		tags["charge_is_approx"] = "true"
+	}
+
+	for key, field := range stringFields {
+		if raw, ok := variables[key]; ok {
+			fields[field] = raw
+		}
+	}
+
+	if severity, ok := batteryStatusSeverity[strings.ToLower(variables["battery.status"])]; ok {
+		fields["battery_status_severity"] = severity
+	}
+
+	if raw, ok := variables["ups.mfr.date"]; ok {
+		if date, err := parseDate(raw); err == nil {
+			fields["ups_age_days"] = int64(now().Sub(date).Hours() / 24)
+		} else {
+			u.Log.Debugf("Parsing ups.mfr.date=%q of %q failed: %v", raw, name, err)
+		}
+	}
+
+	if deviation, ok := u.outputVoltageError(variables); ok {
+		fields["output_voltage_error_percent"] = deviation
+	}
+
+	u.addLastTransfer(name, variables, fields)
+
+	if efficiency, ok := u.measuredEfficiency(variables); ok {
+		fields["measured_efficiency_percent"] = efficiency
+	}
+
+	if pf, ok := u.powerFactor(variables); ok {
+		fields["power_factor"] = pf
+	}
+
+	if u.BatteryHealthScore {
+		if score, ok := u.batteryHealthScore(variables); ok {
+			fields["battery_health_score"] = score
+		}
+	}
+
+	if u.IncludeInterval {
+		if interval, ok := u.collectionInterval(key, ep); ok {
+			fields["interval_s"] = interval.Seconds()
+		}
+	}
+
+	if cached, ok := u.slowCache[key]; ok {
+		if u.SlowCacheMaxAge > 0 && now().Sub(cached.collected) > time.Duration(u.SlowCacheMaxAge) {
+			delete(u.slowCache, key)
+		} else {
+			fields["clients"] = cached.clients
+			fields["instant_commands"] = cached.commands
+		}
+	}
+
+	u.validateRanges(fields, tags)
+	if !u.stale {
+		u.fleet.add(variables["ups.status"], fields)
+	}
+	// Merged metrics are split after averaging when flushed
+	if u.SplitElectrical && !(u.MergeBySerial && tags["serial"] != "") {
+		u.gatherElectrical(acc, fields, tags)
+	}
+	u.addFields(acc, "upsd", fields, tags)
+	u.gatherOutlets(acc, variables, tags)
+	u.gatherEfficiency(acc, variables, tags)
+	u.gatherRuntimes(acc, key, name, variables, tags)
+}
+
+// gatherElectrical moves the electrical fields into a separate
+// upsd_electrical metric
+func (u *Upsd) gatherElectrical(acc telegraf.Accumulator, fields map[string]interface{}, upsTags map[string]string) {
+	electrical := make(map[string]interface{})
+	for _, field := range electricalFields {
+		if value, ok := fields[field]; ok {
+			electrical[field] = value
+			delete(fields, field)
+		}
+	}
+	if len(electrical) == 0 {
+		return
+	}
+
+	u.addFields(acc, "upsd_electrical", electrical, derivedTags(upsTags))
+}
+
+// derivedTags returns the tags identifying the UPS for the metrics derived
+// from its upsd metric
+func derivedTags(upsTags map[string]string) map[string]string {
+	tags := make(map[string]string)
+	for _, k := range derivedTagKeys {
+		if v, ok := upsTags[k]; ok {
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+// outputVoltageError returns the deviation of the output voltage from its
+// nominal value in percent, a growing deviation can indicate a failing
+// inverter.
+func (u *Upsd) outputVoltageError(variables map[string]string) (float64, bool) {
+	voltage, errVoltage := u.parseFloat(variables["output.voltage"])
+	nominal, errNominal := u.parseFloat(variables["output.voltage.nominal"])
+	if errVoltage != nil || errNominal != nil || nominal == 0 {
+		return 0, false
+	}
+	return 100 * (voltage - nominal) / nominal, true
+}
+
+// underloaded checks if the load is below the configured minimum or the
+// ups.load.low threshold of the device. The second return value is false
+// if the load or the threshold is unknown.
+func (u *Upsd) underloaded(variables map[string]string) (bool, bool) {
+	load, err := u.parseFloat(variables["ups.load"])
+	if err != nil {
+		return false, false
+	}
+
+	threshold := u.MinLoad
+	if threshold <= 0 {
+		if threshold, err = u.parseFloat(variables["ups.load.low"]); err != nil {
+			return false, false
+		}
+	}
+	return load < threshold, true
+}
+
+// powerFactor returns the nominal power factor as reported by the driver
+// or as computed from the nominal real and apparent power.
+func (u *Upsd) powerFactor(variables map[string]string) (float64, bool) {
+	if raw, ok := variables["ups.realpower.nominal.percent"]; ok {
+		if percent, err := u.parseFloat(raw); err == nil {
+			return percent / 100, true
+		}
+	}
+
+	realPower, errReal := u.parseFloat(variables["ups.realpower.nominal"])
+	apparentPower, errApparent := u.parseFloat(variables["ups.power.nominal"])
+	if errReal != nil || errApparent != nil || apparentPower == 0 {
+		return 0, false
+	}
+	return realPower / apparentPower, true
+}
+
+// omitEmptyValues returns the variables without the ones having an empty
+// value except for the status variables.
+func omitEmptyValues(variables map[string]string) map[string]string {
+	result := make(map[string]string, len(variables))
+	for key, value := range variables {
+		if value == "" && !strings.HasSuffix(key, ".status") {
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// parseRuntime converts the battery runtime to seconds. Most drivers report
+// plain seconds but some format the runtime as "HH:MM:SS" clock string.
+func parseRuntime(raw string) (int64, error) {
+	parts := strings.Split(raw, ":")
+	if len(parts) != 3 {
+		return strconv.ParseInt(raw, 10, 64)
+	}
+
+	var seconds int64
+	for i, part := range parts {
+		value, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || value < 0 || (i > 0 && (len(part) != 2 || value >= 60)) {
+			return 0, fmt.Errorf("invalid clock format %q", raw)
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds, nil
+}
+
+// timeLeft converts the runtime in seconds to nanoseconds clamping it to
+// the maximum time left to avoid overflows on huge runtimes.
+func (u *Upsd) timeLeft(key, name, variable string, seconds int64) int64 {
+	limit := int64(math.MaxInt64)
+	if u.MaxTimeLeft > 0 {
+		limit = int64(u.MaxTimeLeft)
+	}
+	clamped := seconds > limit/int64(time.Second)
+
+	// Warn once until the value returns to range instead of every gather
+	if !u.stale {
+		s, _ := u.state(key)
+		if clamped && !s.clamped[variable] {
+			u.Log.Warnf("Clamping %s=%d of %q to %s", variable, seconds, name, time.Duration(limit))
+			if s.clamped == nil {
+				s.clamped = make(map[string]bool)
+			}
+			s.clamped[variable] = true
+		} else if !clamped {
+			delete(s.clamped, variable)
+		}
+	}
+
+	if clamped {
+		return limit
+	}
+	return seconds * int64(time.Second)
+}
+
+// addFields adds the metric to the accumulator sanitizing the field keys
+// if requested.
+func (u *Upsd) addFields(acc telegraf.Accumulator, measurement string, fields map[string]interface{}, tags map[string]string) {
+	if u.stale || u.agentHost != "" {
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		if u.stale {
+			tags["stale"] = "true"
+		}
+		if u.agentHost != "" {
+			tags["agent_host"] = u.agentHost
+		}
+	}
+	if u.MergeBySerial && measurement == "upsd" && u.merge(fields, tags) {
+		return
+	}
+	acc.AddFields(measurement, fields, tags, u.timestamps()...)
+	u.emittedMetrics++
+}
+
+// timestamps returns the timestamp for the emitted metrics if aligned
+func (u *Upsd) timestamps() []time.Time {
+	if !u.AlignTimestamps {
+		return nil
+	}
+	return []time.Time{u.gatherTime}
+}
+
+// addNumber parses the given variable, if present, and adds it as field
+func (u *Upsd) addNumber(acc telegraf.Accumulator, fields map[string]interface{}, field, key string, variables map[string]string) {
+	raw, ok := variables[key]
+	if !ok {
+		return
+	}
+
+	value, err := u.parseNumber(raw)
+	if err != nil {
+		acc.AddError(fmt.Errorf("converting %s=%q failed: %w", key, raw, err))
+		return
+	}
+	fields[field] = value
+}
+
+// parseNumber converts the raw variable value to an integer or float
+// depending on the representation and the force_float setting.
+func (u *Upsd) parseNumber(raw string) (interface{}, error) {
+	if u.DecimalSeparator != "" && u.DecimalSeparator != "." {
+		raw = strings.Replace(raw, u.DecimalSeparator, ".", 1)
+	}
+	if !u.ForceFloat {
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return v, nil
+		}
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+// parseFloat converts the raw variable value to a float honoring the
+// decimal separator, e.g. for fields derived from multiple variables.
+func (u *Upsd) parseFloat(raw string) (float64, error) {
+	value, err := u.parseNumber(raw)
+	if err != nil {
+		return 0, err
+	}
+	if v, ok := value.(int64); ok {
+		return float64(v), nil
+	}
+	return value.(float64), nil
+}
+
+func (u *Upsd) normalizeSerial(serial string) string {
+	if u.TrimSerial {
+		serial = strings.TrimSpace(serial)
+	}
+	if u.UppercaseSerial {
+		serial = strings.ToUpper(serial)
+	}
+	return serial
+}
+
+// upsKey identifies a UPS across all servers for keeping state
+func upsKey(ep endpoint, name string) string {
+	return ep.address() + "/" + name
+}
+
+func firstOf(variables map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := variables[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// mapStatus adds a tag for each status token and returns the apcupsd
+// compatible status bits and the number of tokens not defined by NUT.
+func (u *Upsd) mapStatus(variables map[string]string, tags map[string]string) (uint64, int) {
+	status := uint64(0)
+	unknown := 0
+	for _, token := range u.statusTokens(variables) {
+		tags["status_"+token] = "true"
+
+		if bit := indexOf(token, statusBits); bit >= 0 {
+			status |= 1 << uint(bit)
+		} else if !choice.Contains(token, knownStatusTokens) {
+			unknown++
+		}
+	}
+	return status, unknown
+}
+
+// statusTokens returns the active status tokens except the ignored ones
+func (u *Upsd) statusTokens(variables map[string]string) []string {
+	tokens := make([]string, 0)
+	for _, token := range strings.Fields(variables["ups.status"]) {
+		if choice.Contains(token, builtinIgnoredStatusTokens) || choice.Contains(token, u.IgnoreStatusTokens) {
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func indexOf(token string, tokens []string) int {
+	for i, t := range tokens {
+		if t == token {
+			return i
+		}
+	}
+	return -1
+}
+
+// credentials returns the username and password for authenticating
+// against the given server, both are empty for anonymous access.
+func (u *Upsd) credentials(ep endpoint) (string, string) {
+	switch ep.auth {
+	case authTLS, authNone:
+		return "", ""
+	case authPassword:
+		return ep.username, ep.password
+	}
+	if u.Username == "" || u.Password == "" {
+		return "", ""
+	}
+	return u.Username, u.Password
+}
+
+// nutUser returns the username used for collecting from the given server
+func (u *Upsd) nutUser(ep endpoint) string {
+	if u.Backend == backendGRPC {
+		return ""
+	}
+	username, _ := u.credentials(ep)
+	return username
+}
+
+func (u *Upsd) connect(ep endpoint) (*client, error) {
+	c, err := dial(ep.address(), time.Duration(u.Timeout))
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	if u.TraceProtocol {
+		address := ep.address()
+		c.trace = func(format string, args ...interface{}) {
+			u.Log.Debugf("%s "+format, append([]interface{}{address}, args...)...)
+		}
+	}
+	if u.ResponseTimePercentiles {
+		address := ep.address()
+		c.observe = func(d time.Duration) {
+			u.observeResponseTime(address, d)
+		}
+	}
+
+	if ep.auth == authTLS {
+		err = c.startTLS(ep.tlsConfig)
+	}
+	username, password := u.credentials(ep)
+	authenticated := ep.auth == authTLS
+	if err == nil && username != "" && password != "" {
+		err = c.authenticate(username, password)
+		authenticated = true
+	}
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+
+	if authenticated {
+		if u.lastAuth == nil {
+			u.lastAuth = make(map[string]time.Time)
+		}
+		u.lastAuth[ep.address()] = now()
+	}
+	return c, nil
+}
+
+// fetchWithRetries reads the variables retrying on errors as long as the
+// retry budget of the gather is not exhausted.
+func (u *Upsd) fetchWithRetries(ep endpoint) (map[string]map[string]string, []string, error) {
+	upsList, timedOut, err := u.fetchVariables(ep)
+	for attempt := 0; err != nil && attempt < u.Retries; attempt++ {
+		if u.RetryBudget > 0 && u.retrySpent >= time.Duration(u.RetryBudget) {
+			u.Log.Debugf("Retry budget exhausted, not retrying %s", ep.address())
+			break
+		}
+		delay := backoff(time.Duration(u.RetryBackoff), time.Duration(u.MaxBackoff), attempt)
+		if remaining := time.Duration(u.RetryBudget) - u.retrySpent; u.RetryBudget > 0 && delay > remaining {
+			delay = remaining
+		}
+		u.Log.Debugf("Retrying %s in %s after error: %v", ep.address(), delay, err)
+		if delay > 0 {
+			sleep(delay)
+			u.retrySpent += delay
+		}
+
+		start := time.Now()
+		upsList, timedOut, err = u.fetchVariables(ep)
+		u.retrySpent += time.Since(start)
+	}
+	return upsList, timedOut, err
+}
+
+// fetchVariables reads the variables of all UPSes of the server. With a
+// per-UPS timeout, UPSes not answering in time are skipped and returned
+// separately.
+func (u *Upsd) fetchVariables(ep endpoint) (map[string]map[string]string, []string, error) {
+	if u.Backend == backendGRPC {
+		upsList, err := u.fetchGRPC()
+		return upsList, nil, err
+	}
+
+	// Some proxies close the connection right after listing the UPSes, so
+	// reconnect and list them again once before failing
+	upsList, timedOut, err := u.fetchServer(ep)
+	if isClosedConnection(err) {
+		u.Log.Debugf("Connection closed by %s, reconnecting: %v", ep.address(), err)
+		upsList, timedOut, err = u.fetchServer(ep)
+	}
+	return upsList, timedOut, err
+}
+
+// isClosedConnection checks if the error was caused by the server closing
+// the connection
+func isClosedConnection(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// fetchServer reads the variables of all UPSes using a single connection
+func (u *Upsd) fetchServer(ep endpoint) (map[string]map[string]string, []string, error) {
+	c, err := u.connect(ep)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if c != nil {
+			c.close()
+		}
+	}()
+
+	upsList, err := c.listUPS()
+	if err != nil {
+		return nil, nil, fmt.Errorf("list ups: %w", err)
+	}
+
+	if u.descriptions == nil {
+		u.descriptions = make(map[string]string)
+	}
+
+	result := make(map[string]map[string]string, len(upsList))
+	var timedOut []string
+	for _, ups := range upsList {
+		// upsd reports "Unavailable" for UPSes without description
+		if ups.Description != "" && ups.Description != "Unavailable" {
+			u.descriptions[upsKey(ep, ups.Name)] = ups.Description
+		} else {
+			delete(u.descriptions, upsKey(ep, ups.Name))
+		}
+
+		if u.UpsTimeout > 0 {
+			if err := c.setDeadline(time.Duration(u.UpsTimeout)); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		variables, err := u.readVariables(c, ups.Name)
+		var netErr net.Error
+		if u.UpsTimeout > 0 && errors.As(err, &netErr) && netErr.Timeout() {
+			u.Log.Warnf("Reading variables of %q from %s timed out", ups.Name, ep.address())
+			timedOut = append(timedOut, ups.Name)
+
+			// The state of the connection is undefined after the timeout
+			c.close()
+			if c, err = u.connect(ep); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		result[ups.Name] = variables
+	}
+
+	if err := c.logout(); err != nil {
+		u.Log.Debugf("Logout from %s failed: %v", ep.address(), err)
+	}
+	return result, timedOut, nil
+}
+
+func (u *Upsd) readVariables(c *client, ups string) (map[string]string, error) {
+	if u.LightweightMode {
+		variables, err := getVariables(c, ups, lightweightVariables)
+		if err != nil {
+			return nil, fmt.Errorf("get variables of %q: %w", ups, err)
+		}
+		return variables, nil
+	}
+
+	// NUT provides no snapshots, so read all variables of the UPS with a
+	// single command to minimize inconsistencies by driver updates
+	variables, err := c.listVariables(ups)
+	if err != nil {
+		return nil, fmt.Errorf("list variables of %q: %w", ups, err)
+	}
+	return variables, nil
+}
+
+// getVariables queries the given variables individually skipping the ones
+// not supported by the UPS.
+func getVariables(c *client, ups string, names []string) (map[string]string, error) {
+	variables := make(map[string]string, len(names))
+	for _, name := range names {
+		value, err := c.getVariable(ups, name)
+		if err != nil {
+			var perr *protocolError
+			if errors.As(err, &perr) && perr.Code == "VAR-NOT-SUPPORTED" {
+				continue
+			}
+			return nil, err
+		}
+		variables[name] = value
+	}
+	return variables, nil
+}
+
+// fetchSlow collects the rarely changing data of the given UPSes and
+// updates the cache. UPSes failing to collect keep their cached values.
+func (u *Upsd) fetchSlow(ep endpoint, upsList map[string]map[string]string) error {
+	c, err := u.connect(ep)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	if u.slowCache == nil {
+		u.slowCache = make(map[string]*slowData)
+	}
+
+	var lastErr error
+	for name := range upsList {
+		clients, err := c.listClients(name)
+		if err != nil {
+			lastErr = fmt.Errorf("list clients of %q: %w", name, err)
+			continue
+		}
+		commands, err := c.listCommands(name)
+		if err != nil {
+			lastErr = fmt.Errorf("list commands of %q: %w", name, err)
+			continue
+		}
+		u.slowCache[upsKey(ep, name)] = &slowData{
+			clients:   len(clients),
+			commands:  len(commands),
+			collected: now(),
+		}
+	}
+
+	if err := c.logout(); err != nil {
+		u.Log.Debugf("Logout from %s failed: %v", ep.address(), err)
+	}
+	return lastErr
+}
+
+func init() {
+	inputs.Add("upsd", func() telegraf.Input {
+		return &Upsd{
+			Server:             defaultAddress,
+			Port:               defaultPort,
+			Timeout:            defaultTimeout,
+			TrimSerial:         true,
+			DecimalSeparator:   ".",
+			EmptyValues:        emptyValuesOmit,
+			Backend:            backendNUT,
+			DiscoveryInterval:  defaultDiscoveryInterval,
+			CacheMaxAge:        defaultCacheMaxAge,
+			ResponseTimeWindow: defaultResponseTimeWindow,
+		}
+	})
+}
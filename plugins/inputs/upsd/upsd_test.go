@@ -0,0 +1,2353 @@
+package upsd
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestUpsdDocs(_ *testing.T) {
+	u := &Upsd{}
+	u.Description()
+	u.SampleConfig()
+}
+
+func TestUpsdInit(t *testing.T) {
+	input, ok := inputs.Inputs["upsd"]
+	require.True(t, ok, "Input not defined")
+
+	_ = input().(*Upsd)
+}
+
+// mockServer answers NUT protocol commands for a fixed set of UPSes.
+type mockServer struct {
+	ups       []string
+	variables map[string]map[string]string
+
+	// responses overrides the answer to a specific command
+	responses map[string]string
+	// delays holds back the answer to a specific command
+	delays map[string]time.Duration
+	// closeAfter closes the connection after answering a specific command
+	// for the given number of times
+	closeAfter map[string]int
+	// password enables authentication, listing the UPSes is denied for
+	// clients not authenticated by password or TLS client certificate
+	password  string
+	tlsConfig *tls.Config
+
+	// commands records all commands received in order
+	commands []string
+	sync.Mutex
+}
+
+func newMockServer() *mockServer {
+	return &mockServer{
+		variables:  make(map[string]map[string]string),
+		responses:  make(map[string]string),
+		delays:     make(map[string]time.Duration),
+		closeAfter: make(map[string]int),
+	}
+}
+
+func (s *mockServer) addUps(name string, variables map[string]string) {
+	s.ups = append(s.ups, name)
+	s.variables[name] = variables
+}
+
+func (s *mockServer) respond(cmd string) string {
+	if resp, ok := s.responses[cmd]; ok {
+		return resp
+	}
+
+	switch {
+	case cmd == "LIST UPS":
+		resp := "BEGIN LIST UPS\n"
+		for _, name := range s.ups {
+			resp += fmt.Sprintf("UPS %s \"Description of %s\"\n", name, name)
+		}
+		return resp + "END LIST UPS\n"
+	case strings.HasPrefix(cmd, "LIST VAR "):
+		name := strings.TrimPrefix(cmd, "LIST VAR ")
+		variables, ok := s.variables[name]
+		if !ok {
+			return "ERR UNKNOWN-UPS\n"
+		}
+		keys := make([]string, 0, len(variables))
+		for k := range variables {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		resp := "BEGIN " + cmd + "\n"
+		for _, k := range keys {
+			resp += fmt.Sprintf("VAR %s %s \"%s\"\n", name, k, variables[k])
+		}
+		return resp + "END " + cmd + "\n"
+	case strings.HasPrefix(cmd, "GET VAR "):
+		parts := strings.Fields(cmd)
+		if len(parts) != 4 {
+			return "ERR INVALID-ARGUMENT\n"
+		}
+		variables, ok := s.variables[parts[2]]
+		if !ok {
+			return "ERR UNKNOWN-UPS\n"
+		}
+		value, ok := variables[parts[3]]
+		if !ok {
+			return "ERR VAR-NOT-SUPPORTED\n"
+		}
+		return fmt.Sprintf("VAR %s %s \"%s\"\n", parts[2], parts[3], value)
+	case strings.HasPrefix(cmd, "LIST CLIENT "):
+		name := strings.TrimPrefix(cmd, "LIST CLIENT ")
+		return "BEGIN " + cmd + "\nCLIENT " + name + " 127.0.0.1\nEND " + cmd + "\n"
+	case strings.HasPrefix(cmd, "LIST CMD "):
+		name := strings.TrimPrefix(cmd, "LIST CMD ")
+		return "BEGIN " + cmd + "\nCMD " + name + " beeper.disable\nCMD " + name + " test.battery.start\nEND " + cmd + "\n"
+	case strings.HasPrefix(cmd, "USERNAME "), strings.HasPrefix(cmd, "PASSWORD "):
+		return "OK\n"
+	case cmd == "LOGOUT":
+		return "OK Goodbye\n"
+	}
+	return "ERR UNKNOWN-COMMAND\n"
+}
+
+func (s *mockServer) listen(t *testing.T) *net.TCPAddr {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr)
+}
+
+func (s *mockServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	s.Lock()
+	authenticated := s.password == "" && s.tlsConfig == nil
+	s.Unlock()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		cmd := scanner.Text()
+		s.Lock()
+		s.commands = append(s.commands, cmd)
+		var resp string
+		switch {
+		case cmd == "STARTTLS" && s.tlsConfig != nil:
+			resp = "OK STARTTLS\n"
+		case strings.HasPrefix(cmd, "PASSWORD ") && s.password != "":
+			resp = "ERR ACCESS-DENIED\n"
+			if strings.TrimPrefix(cmd, "PASSWORD ") == s.password {
+				resp = "OK\n"
+				authenticated = true
+			}
+		case cmd == "LIST UPS" && !authenticated:
+			resp = "ERR ACCESS-DENIED\n"
+		default:
+			resp = s.respond(cmd)
+		}
+		delay := s.delays[cmd]
+		closing := s.closeAfter[cmd] > 0
+		if closing {
+			s.closeAfter[cmd]--
+		}
+		s.Unlock()
+		time.Sleep(delay)
+		if _, err := conn.Write([]byte(resp)); err != nil || closing {
+			return
+		}
+
+		switch cmd {
+		case "LOGOUT":
+			return
+		case "STARTTLS":
+			if s.tlsConfig == nil {
+				continue
+			}
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			authenticated = len(tlsConn.ConnectionState().PeerCertificates) > 0
+			conn = tlsConn
+			scanner = bufio.NewScanner(conn)
+		}
+	}
+}
+
+func TestUpsdGather(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{
+		"battery.charge":          "100",
+		"battery.date":            "2018-05-24",
+		"battery.mfr.date":        "2018-05-24",
+		"battery.runtime":         "1175",
+		"battery.runtime.low":     "300",
+		"battery.voltage":         "27.4",
+		"battery.voltage.nominal": "24.0",
+		"device.model":            "Model 12345",
+		"device.serial":           "ABC123",
+		"input.frequency":         "50.0",
+		"input.transfer.high":     "280",
+		"input.transfer.low":      "160",
+		"input.voltage":           "230.0",
+		"input.voltage.nominal":   "230",
+		"output.voltage":          "230.0",
+		"ups.delay.shutdown":      "20",
+		"ups.delay.start":         "30",
+		"ups.firmware":            "CUSTOM_FIRMWARE",
+		"ups.load":                "8",
+		"ups.realpower":           "41",
+		"ups.realpower.nominal":   "900",
+		"ups.status":              "OL",
+		"ups.temperature":         "25.2",
+	})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server: addr.IP.String(),
+		Port:   addr.Port,
+		Log:    testutil.Logger{},
+	}
+
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd",
+			map[string]string{
+				"serial":          "ABC123",
+				"ups_name":        "fake",
+				"ups_description": "Description of fake",
+				"model":           "Model 12345",
+				"status_OL":       "true",
+			},
+			map[string]interface{}{
+				"status_flags":            uint64(8),
+				"status_unknown_tokens":   0,
+				"ups_status":              "OL",
+				"battery_charge_percent":  int64(100),
+				"battery_date":            "2018-05-24",
+				"battery_mfr_date":        "2018-05-24",
+				"battery_runtime_low":     int64(300),
+				"battery_voltage":         27.4,
+				"firmware":                "CUSTOM_FIRMWARE",
+				"input_frequency":         50.0,
+				"input_transfer_high":     int64(280),
+				"input_transfer_low":      int64(160),
+				"input_voltage":           230.0,
+				"internal_temp":           25.2,
+				"load_percent":            int64(8),
+				"nominal_battery_voltage": 24.0,
+				"nominal_input_voltage":   int64(230),
+				"nominal_power":           int64(900),
+				"output_voltage":          230.0,
+				"real_power":              int64(41),
+				"time_left_ns":            int64(1175000000000),
+				"ups_delay_shutdown":      int64(20),
+				"ups_delay_start":         int64(30),
+				"shutdown_delay_enabled":  true,
+				"start_delay_enabled":     true,
+			},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd_server",
+			map[string]string{"server": addr.String()},
+			map[string]interface{}{"distinct_models": 1},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd_servers",
+			map[string]string{},
+			map[string]interface{}{
+				"configured":      1,
+				"reachable":       1,
+				"reachable_ratio": 1.0,
+			},
+			time.Unix(0, 0),
+		),
+	}
+
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+}
+
+func TestUpsdGatherDistinctModels(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake1", map[string]string{"device.model": "Model A", "ups.status": "OL"})
+	server.addUps("fake2", map[string]string{"ups.model": "Model B", "ups.status": "OL"})
+	server.addUps("fake3", map[string]string{"device.model": "Model A", "ups.status": "OL"})
+	server.addUps("fake4", map[string]string{"ups.status": "OL"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server: addr.IP.String(),
+		Port:   addr.Port,
+		Log:    testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	acc.AssertContainsTaggedFields(t, "upsd_server",
+		map[string]interface{}{"distinct_models": 2},
+		map[string]string{"server": addr.String()},
+	)
+}
+
+func TestUpsdSnapshotMode(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:       addr.IP.String(),
+		Port:         addr.Port,
+		SnapshotMode: true,
+		Log:          testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	for i := 0; i < 3; i++ {
+		require.NoError(t, plugin.Gather(&acc))
+	}
+	require.NoError(t, acc.FirstError())
+
+	server.Lock()
+	defer server.Unlock()
+	var gathers int
+	for _, cmd := range server.commands {
+		if cmd == "LIST UPS" {
+			gathers++
+		}
+	}
+	require.Equal(t, 1, gathers)
+	require.Len(t, acc.GetTelegrafMetrics(), 3)
+}
+
+func TestUpsdGatherClosedAfterListUps(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake1", map[string]string{"ups.status": "OL"})
+	server.addUps("fake2", map[string]string{"ups.status": "OB"})
+	server.closeAfter["LIST UPS"] = 1
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server: addr.IP.String(),
+		Port:   addr.Port,
+		Log:    testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	var names []string
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "upsd" {
+			names = append(names, m.Tags()["ups_name"])
+		}
+	}
+	require.ElementsMatch(t, []string{"fake1", "fake2"}, names)
+
+	server.Lock()
+	defer server.Unlock()
+	require.Equal(t, []string{"LIST UPS", "LIST UPS", "LIST VAR fake1", "LIST VAR fake2", "LOGOUT"}, server.commands)
+}
+
+func TestUpsdGatherClosedConnection(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	server.closeAfter["LIST UPS"] = 2
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server: addr.IP.String(),
+		Port:   addr.Port,
+		Log:    testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.Error(t, acc.FirstError())
+	require.False(t, acc.HasMeasurement("upsd"))
+}
+
+func TestUpsdGatherUpsTimeout(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake1", map[string]string{"ups.status": "OL"})
+	server.addUps("hanging", map[string]string{"ups.status": "OL"})
+	server.addUps("fake2", map[string]string{"ups.status": "OB"})
+	server.delays["LIST VAR hanging"] = 2 * time.Second
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:     addr.IP.String(),
+		Port:       addr.Port,
+		UpsTimeout: config.Duration(100 * time.Millisecond),
+		Log:        testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	start := time.Now()
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.Less(t, time.Since(start), time.Second)
+
+	reachable := make(map[string]bool)
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() != "upsd" {
+			continue
+		}
+		value, ok := m.GetField("reachable")
+		require.True(t, ok)
+		reachable[m.Tags()["ups_name"]] = value.(bool)
+	}
+	require.Equal(t, map[string]bool{"fake1": true, "hanging": false, "fake2": true}, reachable)
+
+	acc.AssertContainsTaggedFields(t, "upsd",
+		map[string]interface{}{"reachable": false},
+		map[string]string{"ups_name": "hanging", "ups_description": "Description of hanging"},
+	)
+}
+
+func TestUpsdAlignTimestamps(t *testing.T) {
+	var servers []string
+	for _, name := range []string{"fake1", "fake2"} {
+		server := newMockServer()
+		server.addUps(name, map[string]string{"ups.status": "OL", "outlet.1.status": "on"})
+		server.delays["LIST VAR "+name] = 10 * time.Millisecond
+		servers = append(servers, server.listen(t).String())
+	}
+
+	timestamps := func(align bool) map[time.Time]bool {
+		plugin := &Upsd{Servers: servers, AlignTimestamps: align, Log: testutil.Logger{}}
+		require.NoError(t, plugin.Init())
+
+		var acc testutil.Accumulator
+		require.NoError(t, plugin.Gather(&acc))
+		require.NoError(t, acc.FirstError())
+		require.Len(t, acc.GetTelegrafMetrics(), 7)
+
+		result := make(map[time.Time]bool)
+		for _, m := range acc.GetTelegrafMetrics() {
+			result[m.Time()] = true
+		}
+		return result
+	}
+
+	require.Greater(t, len(timestamps(false)), 1)
+	require.Len(t, timestamps(true), 1)
+}
+
+func TestUpsdSkipOffUPS(t *testing.T) {
+	server := newMockServer()
+	server.addUps("on", map[string]string{"ups.status": "OL", "outlet.1.status": "on"})
+	server.addUps("off", map[string]string{"ups.status": "OFF", "outlet.1.status": "off"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:     addr.IP.String(),
+		Port:       addr.Port,
+		SkipOffUPS: true,
+		Log:        testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	var names []string
+	for _, m := range acc.GetTelegrafMetrics() {
+		if name, ok := m.GetTag("ups_name"); ok {
+			names = append(names, m.Name()+"/"+name)
+		}
+	}
+	require.ElementsMatch(t, []string{"upsd/on", "upsd_outlet/on"}, names)
+	acc.AssertContainsFields(t, "upsd_servers", map[string]interface{}{
+		"configured":      1,
+		"reachable":       1,
+		"reachable_ratio": 1.0,
+	})
+
+	// Without the option the UPS is reported
+	plugin.SkipOffUPS = false
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(&acc))
+	acc.AssertContainsTaggedFields(t, "upsd",
+		map[string]interface{}{"status_flags": uint64(0), "status_unknown_tokens": 0, "ups_status": "OFF"},
+		map[string]string{"ups_name": "off", "ups_description": "Description of off", "status_OFF": "true"},
+	)
+}
+
+func TestUpsdRetryBudget(t *testing.T) {
+	newFailingServer := func() (*mockServer, string) {
+		server := newMockServer()
+		server.responses["LIST UPS"] = "ERR DRIVER-NOT-CONNECTED\n"
+		server.delays["LIST UPS"] = 20 * time.Millisecond
+		return server, server.listen(t).String()
+	}
+	attempts := func(server *mockServer) int {
+		server.Lock()
+		defer server.Unlock()
+		var count int
+		for _, cmd := range server.commands {
+			if cmd == "LIST UPS" {
+				count++
+			}
+		}
+		return count
+	}
+
+	// Retries without budget
+	server, addr := newFailingServer()
+	plugin := &Upsd{Servers: []string{addr}, Retries: 3, Log: testutil.Logger{}}
+	require.NoError(t, plugin.Init())
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	require.Equal(t, 4, attempts(server))
+
+	// The budget is shared across all servers
+	first, firstAddr := newFailingServer()
+	second, secondAddr := newFailingServer()
+	plugin = &Upsd{
+		Servers:     []string{firstAddr, secondAddr},
+		Retries:     1000,
+		RetryBudget: config.Duration(100 * time.Millisecond),
+		Log:         testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+	acc = testutil.Accumulator{}
+	start := time.Now()
+	require.NoError(t, plugin.Gather(&acc))
+	require.Less(t, time.Since(start), time.Second)
+	require.Len(t, acc.Errors, 2)
+	require.Greater(t, attempts(first), 1)
+	require.LessOrEqual(t, attempts(first), 10)
+	require.Equal(t, 1, attempts(second))
+
+	// The budget is renewed for each gather
+	acc = testutil.Accumulator{}
+	require.NoError(t, plugin.Gather(&acc))
+	require.Greater(t, attempts(first), 2)
+}
+
+func TestUpsdGatherSingleListPerUps(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake1", map[string]string{"battery.charge": "100", "ups.status": "OL"})
+	server.addUps("fake2", map[string]string{"battery.charge": "50", "ups.status": "OB"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server: addr.IP.String(),
+		Port:   addr.Port,
+		Log:    testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	server.Lock()
+	defer server.Unlock()
+	require.Equal(t, []string{"LIST UPS", "LIST VAR fake1", "LIST VAR fake2", "LOGOUT"}, server.commands)
+}
+
+func TestUpsdGatherDescription(t *testing.T) {
+	server := newMockServer()
+	server.addUps("described", map[string]string{"ups.status": "OL"})
+	server.addUps("empty", map[string]string{"ups.status": "OL"})
+	server.addUps("unavailable", map[string]string{"ups.status": "OL"})
+	server.responses["LIST UPS"] = "BEGIN LIST UPS\n" +
+		"UPS described \"Server room \\\"A\\\" rack 3\"\n" +
+		"UPS empty \"\"\n" +
+		"UPS unavailable \"Unavailable\"\n" +
+		"END LIST UPS\n"
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server: addr.IP.String(),
+		Port:   addr.Port,
+		Log:    testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	descriptions := make(map[string]string)
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() != "upsd" {
+			continue
+		}
+		description, ok := m.GetTag("ups_description")
+		if ok {
+			descriptions[m.Tags()["ups_name"]] = description
+		}
+	}
+	require.Equal(t, map[string]string{"described": `Server room "A" rack 3`}, descriptions)
+}
+
+func TestUpsdGatherLightweightMode(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{
+		"battery.charge":  "95",
+		"battery.runtime": "1175",
+		"device.serial":   "ABC123",
+		"input.voltage":   "230.0",
+		"outlet.1.status": "on",
+		"ups.status":      "OB",
+	})
+	server.addUps("nocharge", map[string]string{
+		"input.voltage": "230.0",
+		"ups.status":    "OL",
+	})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:              addr.IP.String(),
+		Port:                addr.Port,
+		LightweightMode:     true,
+		EmitEvents:          true,
+		SlowCollectInterval: config.Duration(time.Minute),
+		Log:                 testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd",
+			map[string]string{"ups_name": "fake", "ups_description": "Description of fake", "status_OB": "true"},
+			map[string]interface{}{
+				"status_flags":           uint64(16),
+				"status_unknown_tokens":  0,
+				"ups_status":             "OB",
+				"battery_charge_percent": int64(95),
+			},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd",
+			map[string]string{"ups_name": "nocharge", "ups_description": "Description of nocharge", "status_OL": "true"},
+			map[string]interface{}{
+				"status_flags":          uint64(8),
+				"status_unknown_tokens": 0,
+				"ups_status":            "OL",
+			},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd_servers",
+			map[string]string{},
+			map[string]interface{}{
+				"configured":      1,
+				"reachable":       1,
+				"reachable_ratio": 1.0,
+			},
+			time.Unix(0, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime(), testutil.SortMetrics())
+
+	server.Lock()
+	defer server.Unlock()
+	for _, cmd := range server.commands {
+		require.False(t, strings.HasPrefix(cmd, "LIST VAR"), cmd)
+		require.False(t, strings.HasPrefix(cmd, "LIST CLIENT"), cmd)
+	}
+}
+
+func TestUpsdGatherTimeLeftOverflow(t *testing.T) {
+	tests := []struct {
+		name        string
+		runtime     string
+		maxTimeLeft time.Duration
+		expected    int64
+	}{
+		{name: "regular", runtime: "1175", expected: 1175 * int64(time.Second)},
+		{name: "overflow", runtime: "9300000000", expected: math.MaxInt64},
+		{name: "maximum", runtime: "9223372036854775807", expected: math.MaxInt64},
+		{name: "below limit", runtime: "3600", maxTimeLeft: 24 * time.Hour, expected: int64(time.Hour)},
+		{name: "above limit", runtime: "172800", maxTimeLeft: 24 * time.Hour, expected: int64(24 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &Upsd{MaxTimeLeft: config.Duration(tt.maxTimeLeft), Log: testutil.Logger{}}
+
+			var acc testutil.Accumulator
+			plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+				"battery.runtime": tt.runtime,
+				"ups.status":      "OL",
+			})
+			require.NoError(t, acc.FirstError())
+			timeLeft, ok := acc.Int64Field("upsd", "time_left_ns")
+			require.True(t, ok)
+			require.Equal(t, tt.expected, timeLeft)
+		})
+	}
+}
+
+type warnLogger struct {
+	testutil.Logger
+	warnings []string
+}
+
+func (l *warnLogger) Warnf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestUpsdGatherTimeLeftWarnOnce(t *testing.T) {
+	logger := &warnLogger{}
+	plugin := &Upsd{MaxTimeLeft: config.Duration(24 * time.Hour), Log: logger}
+
+	// Clamped values are warned about once until back in range
+	for _, runtime := range []string{"172800", "172800", "3600", "172800"} {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+			"battery.runtime":     runtime,
+			"battery.runtime.50":  "172800",
+			"battery.runtime.100": "3600",
+			"ups.status":          "OB",
+		})
+		require.NoError(t, acc.FirstError())
+	}
+	require.Equal(t, []string{
+		`Clamping battery.runtime=172800 of "fake" to 24h0m0s`,
+		`Clamping battery.runtime.50=172800 of "fake" to 24h0m0s`,
+		`Clamping battery.runtime=172800 of "fake" to 24h0m0s`,
+	}, logger.warnings)
+}
+
+func TestUpsdGatherClockRuntime(t *testing.T) {
+	tests := []struct {
+		runtime  string
+		expected int64
+	}{
+		{runtime: "00:19:35", expected: 1175},
+		{runtime: "01:00:00", expected: 3600},
+		{runtime: "100:00:01", expected: 360001},
+		{runtime: "1175", expected: 1175},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.runtime, func(t *testing.T) {
+			plugin := &Upsd{Log: testutil.Logger{}}
+
+			var acc testutil.Accumulator
+			plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+				"battery.runtime": tt.runtime,
+				"ups.status":      "OL",
+			})
+			require.NoError(t, acc.FirstError())
+			timeLeft, ok := acc.Int64Field("upsd", "time_left_ns")
+			require.True(t, ok)
+			require.Equal(t, tt.expected*int64(time.Second), timeLeft)
+		})
+	}
+
+	for _, runtime := range []string{"00:60:00", "00:1:00", "-1:00:00", "00:00", "1h"} {
+		plugin := &Upsd{Log: testutil.Logger{}}
+
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+			"battery.runtime": runtime,
+			"ups.status":      "OL",
+		})
+		require.Error(t, acc.FirstError(), runtime)
+		require.False(t, acc.HasField("upsd", "time_left_ns"), runtime)
+	}
+}
+
+func TestUpsdGatherRuntimeAlertThreshold(t *testing.T) {
+	tests := []struct {
+		runtime  string
+		expected bool
+	}{
+		{runtime: "1200", expected: false},
+		{runtime: "600", expected: false},
+		{runtime: "599", expected: true},
+		{runtime: "0", expected: true},
+	}
+
+	plugin := &Upsd{RuntimeAlertThreshold: config.Duration(10 * time.Minute), Log: testutil.Logger{}}
+	for _, tt := range tests {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+			"battery.runtime":     tt.runtime,
+			"battery.runtime.low": "120",
+			"ups.status":          "OB",
+		})
+		require.NoError(t, acc.FirstError())
+		below, ok := acc.BoolField("upsd", "runtime_below_threshold")
+		require.True(t, ok, tt.runtime)
+		require.Equal(t, tt.expected, below, tt.runtime)
+	}
+
+	plugin = &Upsd{Log: testutil.Logger{}}
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"battery.runtime": "60", "ups.status": "OB"})
+	require.False(t, acc.HasField("upsd", "runtime_below_threshold"))
+}
+
+func TestUpsdGatherForceFloat(t *testing.T) {
+	plugin := &Upsd{ForceFloat: true, Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"battery.charge": "100",
+		"ups.load":       "8",
+		"ups.status":     "OB LB",
+	})
+	require.NoError(t, acc.FirstError())
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd",
+			map[string]string{
+				"ups_name":  "fake",
+				"status_OB": "true",
+				"status_LB": "true",
+			},
+			map[string]interface{}{
+				"status_flags":           uint64(80),
+				"status_unknown_tokens":  0,
+				"ups_status":             "OB LB",
+				"battery_charge_percent": 100.0,
+				"load_percent":           8.0,
+			},
+			time.Unix(0, 0),
+		),
+	}
+
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+}
+
+func TestUpsdGatherDecimalSeparator(t *testing.T) {
+	variables := map[string]string{
+		"battery.charge": "95",
+		"input.voltage":  "230,5",
+		"output.voltage": "229.8",
+		"ups.status":     "OL",
+	}
+
+	plugin := &Upsd{DecimalSeparator: ".", Log: testutil.Logger{}}
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+	require.Error(t, acc.FirstError())
+	require.False(t, acc.HasField("upsd", "input_voltage"))
+
+	plugin = &Upsd{DecimalSeparator: ",", Log: testutil.Logger{}}
+	acc = testutil.Accumulator{}
+	plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+	require.NoError(t, acc.FirstError())
+	input, ok := acc.FloatField("upsd", "input_voltage")
+	require.True(t, ok)
+	require.Equal(t, 230.5, input)
+	output, ok := acc.FloatField("upsd", "output_voltage")
+	require.True(t, ok)
+	require.Equal(t, 229.8, output)
+	charge, ok := acc.Int64Field("upsd", "battery_charge_percent")
+	require.True(t, ok)
+	require.Equal(t, int64(95), charge)
+
+	plugin = &Upsd{Server: defaultAddress, Port: defaultPort, DecimalSeparator: ",,"}
+	require.Error(t, plugin.Init())
+}
+
+func TestUpsdGatherApproximateCharge(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"battery.charge.approx": "80",
+		"ups.status":            "OL",
+	})
+	require.NoError(t, acc.FirstError())
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd",
+			map[string]string{
+				"ups_name":         "fake",
+				"status_OL":        "true",
+				"charge_is_approx": "true",
+			},
+			map[string]interface{}{
+				"status_flags":           uint64(8),
+				"status_unknown_tokens":  0,
+				"ups_status":             "OL",
+				"battery_charge_percent": int64(80),
+			},
+			time.Unix(0, 0),
+		),
+	}
+
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+}
+
+func TestUpsdGatherStatusTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		ignore  []string
+		tags    map[string]string
+		flags   uint64
+		unknown int
+	}{
+		{
+			name:   "known tokens",
+			status: "OL CHRG",
+			tags:   map[string]string{"ups_name": "fake", "status_OL": "true", "status_CHRG": "true"},
+			flags:  8,
+		},
+		{
+			name:    "unknown tokens",
+			status:  "OL FOO",
+			tags:    map[string]string{"ups_name": "fake", "status_OL": "true", "status_FOO": "true"},
+			flags:   8,
+			unknown: 1,
+		},
+		{
+			name:   "builtin ignored tokens",
+			status: "TICK OL TOCK",
+			tags:   map[string]string{"ups_name": "fake", "status_OL": "true"},
+			flags:  8,
+		},
+		{
+			name:   "configured ignored tokens",
+			status: "OB FOO TICK",
+			ignore: []string{"FOO"},
+			tags:   map[string]string{"ups_name": "fake", "status_OB": "true"},
+			flags:  16,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &Upsd{IgnoreStatusTokens: tt.ignore, Log: testutil.Logger{}}
+
+			var acc testutil.Accumulator
+			plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": tt.status})
+			require.NoError(t, acc.FirstError())
+
+			metrics := acc.GetTelegrafMetrics()
+			require.Len(t, metrics, 1)
+			require.Equal(t, tt.tags, metrics[0].Tags())
+			flags, _ := metrics[0].GetField("status_flags")
+			require.Equal(t, tt.flags, flags)
+			unknown, _ := metrics[0].GetField("status_unknown_tokens")
+			require.Equal(t, int64(tt.unknown), unknown)
+		})
+	}
+}
+
+func TestUpsdGatherStructuredStatus(t *testing.T) {
+	variables := map[string]string{"ups.status": "OL CHRG TICK"}
+
+	tests := []struct {
+		format     string
+		flat       bool
+		structured bool
+	}{
+		{format: "flat", flat: true},
+		{format: "structured", structured: true},
+		{format: "both", flat: true, structured: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			plugin := &Upsd{Server: defaultAddress, Port: defaultPort, StatusFormat: tt.format, Log: testutil.Logger{}}
+			require.NoError(t, plugin.Init())
+
+			var acc testutil.Accumulator
+			plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+			require.NoError(t, acc.FirstError())
+			require.Equal(t, tt.flat, acc.HasField("upsd", "status_flags"))
+			require.Equal(t, tt.flat, acc.HasField("upsd", "status_unknown_tokens"))
+			require.Equal(t, tt.flat, acc.HasField("upsd", "ups_status"))
+
+			raw, ok := acc.StringField("upsd", "status")
+			require.Equal(t, tt.structured, ok)
+			if !tt.structured {
+				return
+			}
+			var status structuredStatus
+			require.NoError(t, json.Unmarshal([]byte(raw), &status))
+			require.Equal(t, structuredStatus{
+				Raw:    "OL CHRG TICK",
+				Flags:  8,
+				Tokens: []string{"OL", "CHRG"},
+			}, status)
+		})
+	}
+
+	plugin := &Upsd{Server: defaultAddress, Port: defaultPort, StatusFormat: "nested"}
+	require.Error(t, plugin.Init())
+}
+
+func TestUpsdGatherDisplayLanguage(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"ups.display.language": "de",
+		"ups.status":           "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	require.Equal(t, "de", acc.TagValue("upsd", "display_language"))
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": "OL"})
+	require.False(t, acc.HasTag("upsd", "display_language"))
+}
+
+func TestUpsdGatherDriverPort(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"driver.name":           "usbhid-ups",
+		"driver.parameter.port": "/dev/ttyUSB0",
+		"ups.status":            "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	require.Equal(t, "/dev/ttyUSB0", acc.TagValue("upsd", "driver_port"))
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": "OL"})
+	require.True(t, acc.HasMeasurement("upsd"))
+	require.False(t, acc.HasTag("upsd", "driver_port"))
+}
+
+func TestUpsdGatherUpsID(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"ups.id":     "DC1-ROW4-UPS2",
+		"ups.status": "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	require.Equal(t, "DC1-ROW4-UPS2", acc.TagValue("upsd", "ups_id"))
+
+	for _, variables := range []map[string]string{
+		{"ups.status": "OL"},
+		{"ups.id": "", "ups.status": "OL"},
+	} {
+		acc.ClearMetrics()
+		plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+		require.True(t, acc.HasMeasurement("upsd"))
+		require.False(t, acc.HasTag("upsd", "ups_id"))
+	}
+}
+
+func TestUpsdGatherUpsTypeDetail(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"ups.type":        "line-interactive",
+		"ups.type.detail": "online-interactive",
+		"ups.status":      "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	require.Equal(t, "line-interactive", acc.TagValue("upsd", "ups_type"))
+	require.Equal(t, "online-interactive", acc.TagValue("upsd", "ups_type_detail"))
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"ups.type":   "online",
+		"ups.status": "OL",
+	})
+	require.Equal(t, "online", acc.TagValue("upsd", "ups_type"))
+	require.False(t, acc.HasTag("upsd", "ups_type_detail"))
+}
+
+func TestUpsdGatherLoadForecast(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"ups.load":          "20",
+		"ups.load.forecast": "35.5",
+		"ups.status":        "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	forecast, ok := acc.FloatField("upsd", "load_forecast_percent")
+	require.True(t, ok)
+	require.Equal(t, 35.5, forecast)
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.load": "20", "ups.status": "OL"})
+	require.False(t, acc.HasField("upsd", "load_forecast_percent"))
+}
+
+func TestUpsdGatherUnderloaded(t *testing.T) {
+	tests := []struct {
+		name      string
+		minLoad   float64
+		separator string
+		variables map[string]string
+		expected  interface{}
+	}{
+		{
+			name:      "device threshold",
+			variables: map[string]string{"ups.load": "0", "ups.load.low": "5"},
+			expected:  true,
+		},
+		{
+			name:      "above device threshold",
+			variables: map[string]string{"ups.load": "12", "ups.load.low": "5"},
+			expected:  false,
+		},
+		{
+			name:      "configured minimum",
+			minLoad:   2.5,
+			variables: map[string]string{"ups.load": "1", "ups.load.low": "0.5"},
+			expected:  true,
+		},
+		{
+			name:      "decimal comma",
+			separator: ",",
+			variables: map[string]string{"ups.load": "4,5", "ups.load.low": "5"},
+			expected:  true,
+		},
+		{
+			name:      "no threshold",
+			variables: map[string]string{"ups.load": "1"},
+		},
+		{
+			name:      "no load",
+			minLoad:   2.5,
+			variables: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &Upsd{MinLoad: tt.minLoad, DecimalSeparator: tt.separator, Log: testutil.Logger{}}
+			tt.variables["ups.status"] = "OL"
+
+			var acc testutil.Accumulator
+			plugin.gatherUps(&acc, endpoint{}, "fake", tt.variables)
+			require.NoError(t, acc.FirstError())
+
+			underloaded, ok := acc.BoolField("upsd", "underloaded")
+			if tt.expected == nil {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, tt.expected, underloaded)
+		})
+	}
+}
+
+func TestUpsdGatherSplitElectrical(t *testing.T) {
+	plugin := &Upsd{SplitElectrical: true, Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{tagged: true, host: "127.0.0.1", port: defaultPort}, "fake", map[string]string{
+		"battery.charge":        "100",
+		"battery.voltage":       "27.4",
+		"device.serial":         "ABC123",
+		"input.frequency":       "50.0",
+		"input.voltage":         "230.0",
+		"output.voltage":        "229.0",
+		"ups.realpower":         "41",
+		"ups.realpower.nominal": "900",
+		"ups.status":            "OL",
+	})
+	require.NoError(t, acc.FirstError())
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd_electrical",
+			map[string]string{
+				"server":   "127.0.0.1:3493",
+				"serial":   "ABC123",
+				"ups_name": "fake",
+			},
+			map[string]interface{}{
+				"input_frequency": 50.0,
+				"input_voltage":   230.0,
+				"nominal_power":   int64(900),
+				"output_voltage":  229.0,
+				"real_power":      int64(41),
+			},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"upsd",
+			map[string]string{
+				"server":    "127.0.0.1:3493",
+				"serial":    "ABC123",
+				"status_OL": "true",
+				"ups_name":  "fake",
+			},
+			map[string]interface{}{
+				"battery_charge_percent": int64(100),
+				"battery_voltage":        27.4,
+				"status_flags":           uint64(8),
+				"status_unknown_tokens":  0,
+				"ups_status":             "OL",
+			},
+			time.Unix(0, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+}
+
+func TestUpsdGatherDerivedTags(t *testing.T) {
+	ep := endpoint{tagged: true, host: "127.0.0.1", port: defaultPort}
+	plugin := &Upsd{
+		Username:        "monitor",
+		Password:        "secret",
+		TagNutUser:      true,
+		SplitElectrical: true,
+		Log:             testutil.Logger{},
+	}
+	plugin.descriptions = map[string]string{upsKey(ep, "fake"): "Rack 1"}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, ep, "fake", map[string]string{
+		"battery.runtime.50":  "1200",
+		"battery.runtime.100": "600",
+		"device.model":        "Smart-UPS 1500",
+		"device.serial":       "ABC123",
+		"input.voltage":       "230.0",
+		"outlet.1.status":     "on",
+		"ups.efficiency.50":   "94",
+		"ups.efficiency.100":  "96",
+		"ups.status":          "OL",
+	})
+	require.NoError(t, acc.FirstError())
+
+	// The derived metrics carry the tags identifying the UPS only
+	expected := map[string]string{
+		"nut_user":        "monitor",
+		"server":          "127.0.0.1:3493",
+		"serial":          "ABC123",
+		"ups_description": "Rack 1",
+		"ups_name":        "fake",
+	}
+	measurements := make(map[string]bool)
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "upsd" {
+			continue
+		}
+		measurements[m.Name()] = true
+		tags := m.Tags()
+		delete(tags, "load_point")
+		delete(tags, "outlet")
+		require.Equal(t, expected, tags, m.Name())
+	}
+	require.Equal(t, map[string]bool{
+		"upsd_electrical": true,
+		"upsd_efficiency": true,
+		"upsd_outlet":     true,
+		"upsd_runtime":    true,
+	}, measurements)
+}
+
+func TestUpsdGatherBatteryTemperature(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"battery.temperature": "41.5",
+		"ups.temperature":     "28.0",
+		"ups.status":          "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	batteryTemp, ok := acc.FloatField("upsd", "battery_temp")
+	require.True(t, ok)
+	require.Equal(t, 41.5, batteryTemp)
+	internalTemp, ok := acc.FloatField("upsd", "internal_temp")
+	require.True(t, ok)
+	require.Equal(t, 28.0, internalTemp)
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.temperature": "28.0", "ups.status": "OL"})
+	require.False(t, acc.HasField("upsd", "battery_temp"))
+	require.True(t, acc.HasField("upsd", "internal_temp"))
+}
+
+func TestUpsdGatherBatteryStatus(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	tests := []struct {
+		status   string
+		severity int
+	}{
+		{status: "good", severity: 0},
+		{status: "warning", severity: 1},
+		{status: "critical", severity: 2},
+		{status: "Critical", severity: 2},
+	}
+	for _, tt := range tests {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+			"battery.status": tt.status,
+			"ups.status":     "OL",
+		})
+		require.NoError(t, acc.FirstError())
+		status, ok := acc.StringField("upsd", "battery_status")
+		require.True(t, ok, tt.status)
+		require.Equal(t, tt.status, status)
+		severity, ok := acc.IntField("upsd", "battery_status_severity")
+		require.True(t, ok, tt.status)
+		require.Equal(t, tt.severity, severity)
+	}
+
+	// Unknown levels are reported without severity
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"battery.status": "replace", "ups.status": "OL"})
+	require.True(t, acc.HasField("upsd", "battery_status"))
+	require.False(t, acc.HasField("upsd", "battery_status_severity"))
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": "OL"})
+	require.False(t, acc.HasField("upsd", "battery_status"))
+	require.False(t, acc.HasField("upsd", "battery_status_severity"))
+}
+
+func TestUpsdGatherOutputVoltageError(t *testing.T) {
+	tests := []struct {
+		name      string
+		separator string
+		variables map[string]string
+		expected  interface{}
+	}{
+		{
+			name:      "nominal",
+			variables: map[string]string{"output.voltage": "230", "output.voltage.nominal": "230"},
+			expected:  0.0,
+		},
+		{
+			name:      "below nominal",
+			variables: map[string]string{"output.voltage": "218.5", "output.voltage.nominal": "230"},
+			expected:  -5.0,
+		},
+		{
+			name:      "above nominal",
+			variables: map[string]string{"output.voltage": "126", "output.voltage.nominal": "120"},
+			expected:  5.0,
+		},
+		{
+			name:      "decimal comma",
+			separator: ",",
+			variables: map[string]string{"output.voltage": "218,5", "output.voltage.nominal": "230"},
+			expected:  -5.0,
+		},
+		{
+			name:      "zero nominal",
+			variables: map[string]string{"output.voltage": "230", "output.voltage.nominal": "0"},
+		},
+		{
+			name:      "no nominal",
+			variables: map[string]string{"output.voltage": "230"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &Upsd{DecimalSeparator: tt.separator, Log: testutil.Logger{}}
+			tt.variables["ups.status"] = "OL"
+
+			var acc testutil.Accumulator
+			plugin.gatherUps(&acc, endpoint{}, "fake", tt.variables)
+			require.NoError(t, acc.FirstError())
+			deviation, ok := acc.FloatField("upsd", "output_voltage_error_percent")
+			if tt.expected == nil {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.InDelta(t, tt.expected, deviation, 1e-9)
+		})
+	}
+}
+
+func TestUpsdGatherPowerFactor(t *testing.T) {
+	tests := []struct {
+		name      string
+		separator string
+		variables map[string]string
+		expected  interface{}
+	}{
+		{
+			name: "reported",
+			variables: map[string]string{
+				"ups.realpower.nominal.percent": "90",
+				"ups.realpower.nominal":         "800",
+				"ups.power.nominal":             "1000",
+			},
+			expected: 0.9,
+		},
+		{
+			name: "computed",
+			variables: map[string]string{
+				"ups.realpower.nominal": "900",
+				"ups.power.nominal":     "1500",
+			},
+			expected: 0.6,
+		},
+		{
+			name:      "reported decimal comma",
+			separator: ",",
+			variables: map[string]string{"ups.realpower.nominal.percent": "90,5"},
+			expected:  0.905,
+		},
+		{
+			name:      "computed decimal comma",
+			separator: ",",
+			variables: map[string]string{
+				"ups.realpower.nominal": "900,0",
+				"ups.power.nominal":     "1500,0",
+			},
+			expected: 0.6,
+		},
+		{
+			name: "zero apparent power",
+			variables: map[string]string{
+				"ups.realpower.nominal": "900",
+				"ups.power.nominal":     "0",
+			},
+		},
+		{
+			name:      "absent",
+			variables: map[string]string{"ups.realpower.nominal": "900"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &Upsd{DecimalSeparator: tt.separator, Log: testutil.Logger{}}
+			tt.variables["ups.status"] = "OL"
+
+			var acc testutil.Accumulator
+			plugin.gatherUps(&acc, endpoint{}, "fake", tt.variables)
+			require.NoError(t, acc.FirstError())
+			pf, ok := acc.FloatField("upsd", "power_factor")
+			if tt.expected == nil {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.InDelta(t, tt.expected, pf, 1e-9)
+		})
+	}
+}
+
+func TestUpsdGatherDriverPollParameters(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"driver.parameter.pollfreq":     "30",
+		"driver.parameter.pollinterval": "2",
+		"ups.status":                    "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	pollfreq, ok := acc.Int64Field("upsd", "driver_pollfreq")
+	require.True(t, ok)
+	require.Equal(t, int64(30), pollfreq)
+	pollinterval, ok := acc.Int64Field("upsd", "driver_pollinterval")
+	require.True(t, ok)
+	require.Equal(t, int64(2), pollinterval)
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": "OL"})
+	require.False(t, acc.HasField("upsd", "driver_pollfreq"))
+	require.False(t, acc.HasField("upsd", "driver_pollinterval"))
+}
+
+func TestUpsdGatherRTCBatteryStatus(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"battery.charge":     "100",
+		"battery.rtc.status": "low",
+		"ups.status":         "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	value, ok := acc.StringField("upsd", "battery_rtc_status")
+	require.True(t, ok)
+	require.Equal(t, "low", value)
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": "OL"})
+	require.False(t, acc.HasField("upsd", "battery_rtc_status"))
+}
+
+func TestUpsdGatherDelaySentinel(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"ups.delay.shutdown": "20",
+		"ups.delay.start":    "-1",
+		"ups.status":         "OL",
+	})
+	require.NoError(t, acc.FirstError())
+
+	shutdown, ok := acc.Int64Field("upsd", "ups_delay_shutdown")
+	require.True(t, ok)
+	require.Equal(t, int64(20), shutdown)
+	enabled, ok := acc.BoolField("upsd", "shutdown_delay_enabled")
+	require.True(t, ok)
+	require.True(t, enabled)
+
+	require.False(t, acc.HasField("upsd", "ups_delay_start"))
+	enabled, ok = acc.BoolField("upsd", "start_delay_enabled")
+	require.True(t, ok)
+	require.False(t, enabled)
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": "OL"})
+	require.False(t, acc.HasField("upsd", "start_delay_enabled"))
+	require.False(t, acc.HasField("upsd", "shutdown_delay_enabled"))
+}
+
+func TestUpsdGatherChargerStatusReason(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"battery.charger.status":        "resting",
+		"battery.charger.status.reason": "temperature hold",
+		"ups.status":                    "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	status, ok := acc.StringField("upsd", "battery_charger_status")
+	require.True(t, ok)
+	require.Equal(t, "resting", status)
+	reason, ok := acc.StringField("upsd", "battery_charger_status_reason")
+	require.True(t, ok)
+	require.Equal(t, "temperature hold", reason)
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": "OL"})
+	require.False(t, acc.HasField("upsd", "battery_charger_status"))
+	require.False(t, acc.HasField("upsd", "battery_charger_status_reason"))
+}
+
+func TestUpsdGatherDriverState(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	states := []string{"init.starting", "init.quiet", "init.info", "reconnecting", "updateinfo", "quiet", "dumping", "cleanup"}
+	for _, state := range states {
+		var acc testutil.Accumulator
+		plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+			"driver.state": state,
+			"ups.status":   "OL",
+		})
+		require.NoError(t, acc.FirstError())
+		value, ok := acc.StringField("upsd", "driver_state")
+		require.True(t, ok, state)
+		require.Equal(t, state, value)
+	}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{"ups.status": "OL"})
+	require.False(t, acc.HasField("upsd", "driver_state"))
+}
+
+func TestUpsdGatherEmptyValues(t *testing.T) {
+	variables := map[string]string{
+		"battery.charger.status": "",
+		"device.model":           "",
+		"ups.firmware":           "",
+		"ups.status":             "",
+	}
+
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+	require.NoError(t, acc.FirstError())
+	require.False(t, acc.HasField("upsd", "firmware"))
+	status, ok := acc.StringField("upsd", "ups_status")
+	require.True(t, ok)
+	require.Empty(t, status)
+	status, ok = acc.StringField("upsd", "battery_charger_status")
+	require.True(t, ok)
+	require.Empty(t, status)
+
+	plugin.EmptyValues = emptyValuesKeep
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+	require.NoError(t, acc.FirstError())
+	firmware, ok := acc.StringField("upsd", "firmware")
+	require.True(t, ok)
+	require.Empty(t, firmware)
+	require.True(t, acc.HasField("upsd", "battery_charger_status"))
+}
+
+func TestUpsdGatherFirmwareAux(t *testing.T) {
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"ups.firmware":     "UPS 09.3.ID21",
+		"ups.firmware.aux": "ID21/AP9631 6.9.6",
+		"ups.status":       "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	firmware, ok := acc.StringField("upsd", "firmware")
+	require.True(t, ok)
+	require.Equal(t, "UPS 09.3.ID21", firmware)
+	aux, ok := acc.StringField("upsd", "firmware_aux")
+	require.True(t, ok)
+	require.Equal(t, "ID21/AP9631 6.9.6", aux)
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"ups.firmware": "UPS 09.3.ID21",
+		"ups.status":   "OL",
+	})
+	require.True(t, acc.HasField("upsd", "firmware"))
+	require.False(t, acc.HasField("upsd", "firmware_aux"))
+}
+
+func TestUpsdGatherUpsAge(t *testing.T) {
+	now = func() time.Time { return time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	plugin := &Upsd{Log: testutil.Logger{}}
+
+	var acc testutil.Accumulator
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"ups.mfr.date": "2020/06/01",
+		"ups.status":   "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	age, ok := acc.Int64Field("upsd", "ups_age_days")
+	require.True(t, ok)
+	require.Equal(t, int64(365), age)
+	raw, ok := acc.StringField("upsd", "ups_mfr_date")
+	require.True(t, ok)
+	require.Equal(t, "2020/06/01", raw)
+
+	acc.ClearMetrics()
+	plugin.gatherUps(&acc, endpoint{}, "fake", map[string]string{
+		"ups.mfr.date": "CW0923",
+		"ups.status":   "OL",
+	})
+	require.NoError(t, acc.FirstError())
+	require.False(t, acc.HasField("upsd", "ups_age_days"))
+	raw, ok = acc.StringField("upsd", "ups_mfr_date")
+	require.True(t, ok)
+	require.Equal(t, "CW0923", raw)
+}
+
+func TestUpsdGatherSerialNormalization(t *testing.T) {
+	variables := map[string]string{
+		"device.serial": "  abc123 \t",
+		"ups.status":    "OL",
+	}
+
+	tests := []struct {
+		name      string
+		trim      bool
+		uppercase bool
+		expected  string
+	}{
+		{name: "none", expected: "  abc123 \t"},
+		{name: "trim", trim: true, expected: "abc123"},
+		{name: "trim and uppercase", trim: true, uppercase: true, expected: "ABC123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &Upsd{
+				TrimSerial:      tt.trim,
+				UppercaseSerial: tt.uppercase,
+				Log:             testutil.Logger{},
+			}
+
+			var acc testutil.Accumulator
+			plugin.gatherUps(&acc, endpoint{}, "fake", variables)
+			require.Equal(t, tt.expected, acc.TagValue("upsd", "serial"))
+		})
+	}
+}
+
+func TestUpsdSlowCacheMaxAge(t *testing.T) {
+	current := time.Unix(1600000000, 0)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:              addr.IP.String(),
+		Port:                addr.Port,
+		SlowCollectInterval: config.Duration(time.Minute),
+		SlowCacheMaxAge:     config.Duration(5 * time.Minute),
+		Log:                 testutil.Logger{},
+	}
+
+	// Initial gather populates the cache
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	clients, ok := acc.IntField("upsd", "clients")
+	require.True(t, ok)
+	require.Equal(t, 1, clients)
+	commands, ok := acc.IntField("upsd", "instant_commands")
+	require.True(t, ok)
+	require.Equal(t, 2, commands)
+
+	// Slow collection keeps failing, cached values are served until max-age
+	server.Lock()
+	server.responses["LIST CLIENT fake"] = "ERR ACCESS-DENIED\n"
+	server.Unlock()
+	for _, elapsed := range []time.Duration{2 * time.Minute, 4 * time.Minute} {
+		current = time.Unix(1600000000, 0).Add(elapsed)
+		acc.ClearMetrics()
+		acc.Errors = nil
+		require.NoError(t, plugin.Gather(&acc))
+		require.Error(t, acc.FirstError())
+		require.True(t, acc.HasField("upsd", "clients"))
+		require.True(t, acc.HasField("upsd", "instant_commands"))
+	}
+
+	// Cache expired
+	current = time.Unix(1600000000, 0).Add(6 * time.Minute)
+	acc.ClearMetrics()
+	acc.Errors = nil
+	require.NoError(t, plugin.Gather(&acc))
+	require.Error(t, acc.FirstError())
+	require.True(t, acc.HasField("upsd", "ups_status"))
+	require.False(t, acc.HasField("upsd", "clients"))
+	require.False(t, acc.HasField("upsd", "instant_commands"))
+}
+
+func TestUpsdIncludeInterval(t *testing.T) {
+	current := time.Unix(1600000000, 0)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Server:          addr.IP.String(),
+		Port:            addr.Port,
+		IncludeInterval: true,
+		Log:             testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	// The first gather has no previous collection
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.True(t, acc.HasMeasurement("upsd"))
+	require.False(t, acc.HasField("upsd", "interval_s"))
+
+	for _, spacing := range []time.Duration{10 * time.Second, 90 * time.Second, 1500 * time.Millisecond} {
+		current = current.Add(spacing)
+		acc.ClearMetrics()
+		require.NoError(t, plugin.Gather(&acc))
+		require.NoError(t, acc.FirstError())
+		interval, ok := acc.FloatField("upsd", "interval_s")
+		require.True(t, ok)
+		require.Equal(t, spacing.Seconds(), interval)
+	}
+}
+
+func TestUpsdPrivilegedServers(t *testing.T) {
+	privileged := newMockServer()
+	privileged.addUps("fake1", map[string]string{"ups.status": "OL"})
+	privilegedAddr := privileged.listen(t)
+
+	unprivileged := newMockServer()
+	unprivileged.addUps("fake2", map[string]string{"ups.status": "OL"})
+	unprivilegedAddr := unprivileged.listen(t)
+
+	plugin := &Upsd{
+		Servers:             []string{privilegedAddr.String(), unprivilegedAddr.String()},
+		SlowCollectInterval: config.Duration(time.Minute),
+		PrivilegedServers:   []string{privilegedAddr.String()},
+		Log:                 testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	hasCommand := func(server *mockServer, prefix string) bool {
+		server.Lock()
+		defer server.Unlock()
+		for _, cmd := range server.commands {
+			if strings.HasPrefix(cmd, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	require.True(t, hasCommand(privileged, "LIST CLIENT "))
+	require.True(t, hasCommand(privileged, "LIST CMD "))
+	require.False(t, hasCommand(unprivileged, "LIST CLIENT "))
+	require.False(t, hasCommand(unprivileged, "LIST CMD "))
+
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() != "upsd" {
+			continue
+		}
+		_, found := m.GetField("clients")
+		require.Equal(t, m.Tags()["ups_name"] == "fake1", found)
+	}
+}
+
+func TestUpsdReachableRatio(t *testing.T) {
+	first := newMockServer()
+	first.addUps("ups1", map[string]string{"ups.status": "OL"})
+	firstAddr := first.listen(t)
+
+	second := newMockServer()
+	second.addUps("ups2", map[string]string{"ups.status": "OL"})
+	secondAddr := second.listen(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	plugin := &Upsd{
+		Servers: []string{firstAddr.String(), unreachable, secondAddr.String()},
+		Log:     testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	require.Contains(t, acc.Errors[0].Error(), unreachable)
+
+	acc.AssertContainsFields(t, "upsd_servers", map[string]interface{}{
+		"configured":      3,
+		"reachable":       2,
+		"reachable_ratio": 2.0 / 3.0,
+	})
+	require.Equal(t, firstAddr.String(), acc.TagSetValue("upsd", "server"))
+}
+
+func TestUpsdEndpointAuth(t *testing.T) {
+	pki := testutil.NewPKI("../../../testutil/pki")
+
+	passwordServer := newMockServer()
+	passwordServer.password = "secret"
+	passwordServer.addUps("ups1", map[string]string{"ups.status": "OL"})
+	passwordAddr := passwordServer.listen(t)
+
+	serverTLSConfig, err := pki.TLSServerConfig().TLSConfig()
+	require.NoError(t, err)
+	serverTLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	// The test PKI restricts the server to a legacy cipher suite not offered
+	// by the client, so fall back to the defaults.
+	serverTLSConfig.CipherSuites = nil
+	serverTLSConfig.MinVersion = 0
+	serverTLSConfig.MaxVersion = 0
+	certServer := newMockServer()
+	certServer.tlsConfig = serverTLSConfig
+	certServer.addUps("ups2", map[string]string{"ups.status": "OL"})
+	certAddr := certServer.listen(t)
+
+	plugin := &Upsd{
+		Endpoints: []Endpoint{
+			{
+				Address:  passwordAddr.String(),
+				Username: "user",
+				Password: "secret",
+			},
+			{
+				Address:      certAddr.String(),
+				Auth:         "tls",
+				ClientConfig: *pki.TLSClientConfig(),
+			},
+		},
+		Log: testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	acc.AssertContainsFields(t, "upsd_servers", map[string]interface{}{
+		"configured":      2,
+		"reachable":       2,
+		"reachable_ratio": 1.0,
+	})
+
+	passwordServer.Lock()
+	require.Contains(t, passwordServer.commands, "USERNAME user")
+	require.NotContains(t, passwordServer.commands, "STARTTLS")
+	passwordServer.Unlock()
+
+	certServer.Lock()
+	require.Contains(t, certServer.commands, "STARTTLS")
+	for _, cmd := range certServer.commands {
+		require.False(t, strings.HasPrefix(cmd, "PASSWORD"), cmd)
+	}
+	certServer.Unlock()
+}
+
+func TestUpsdSecondsSinceAuth(t *testing.T) {
+	current := time.Unix(1600000000, 0)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	server := newMockServer()
+	server.password = "secret"
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Endpoints: []Endpoint{{Address: addr.String(), Username: "user", Password: "secret"}},
+		Log:       testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.Equal(t, addr.String(), acc.TagValue("upsd_server", "server"))
+	elapsed, ok := acc.FloatField("upsd_server", "seconds_since_auth")
+	require.True(t, ok)
+	require.Equal(t, 0.0, elapsed)
+	require.False(t, acc.HasField("upsd", "seconds_since_auth"))
+
+	// Failing authentications keep the time of the last successful one
+	server.Lock()
+	server.password = "changed"
+	server.Unlock()
+	current = current.Add(90 * time.Second)
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	require.False(t, acc.HasMeasurement("upsd"))
+	elapsed, ok = acc.FloatField("upsd_server", "seconds_since_auth")
+	require.True(t, ok)
+	require.Equal(t, 90.0, elapsed)
+	require.False(t, acc.HasField("upsd_server", "distinct_models"))
+
+	// Authenticating again resets the time
+	server.Lock()
+	server.password = "secret"
+	server.Unlock()
+	current = current.Add(30 * time.Second)
+	acc = testutil.Accumulator{}
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	elapsed, ok = acc.FloatField("upsd_server", "seconds_since_auth")
+	require.True(t, ok)
+	require.Equal(t, 0.0, elapsed)
+
+	// Servers without authentication do not report the field
+	unauthenticated := newMockServer()
+	unauthenticated.addUps("other", map[string]string{"ups.status": "OL"})
+	unauthenticatedAddr := unauthenticated.listen(t)
+	plugin = &Upsd{Servers: []string{unauthenticatedAddr.String()}, Log: testutil.Logger{}}
+	require.NoError(t, plugin.Init())
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+	require.True(t, acc.HasMeasurement("upsd_server"))
+	require.False(t, acc.HasField("upsd_server", "seconds_since_auth"))
+}
+
+func TestUpsdEndpointAuthInvalid(t *testing.T) {
+	for _, cfg := range []Endpoint{
+		{Address: "localhost", Auth: "kerberos"},
+		{Address: "localhost", Auth: "password", Username: "user"},
+		{Address: "localhost", Auth: "tls"},
+	} {
+		plugin := &Upsd{Endpoints: []Endpoint{cfg}}
+		require.Error(t, plugin.Init(), cfg.Auth)
+	}
+}
+
+func TestUpsdEmitConfig(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	addr := server.listen(t)
+
+	plugin := &Upsd{
+		Servers:            []string{addr.String()},
+		Endpoints:          []Endpoint{{Address: addr.String(), Auth: "password", Username: "user", Password: "secret"}},
+		ForceFloat:         true,
+		IgnoreStatusTokens: []string{"HB", "CHRG"},
+		EmitConfig:         true,
+		Log:                testutil.Logger{},
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"upsd_config",
+			map[string]string{
+				"format":               "float",
+				"ignore_status_tokens": "2",
+				"tls":                  "false",
+				"auth":                 "none,password",
+				"lightweight_mode":     "false",
+				"discovery":            "false",
+			},
+			map[string]interface{}{
+				"servers": 2,
+			},
+			time.Unix(0, 0),
+		),
+	}
+	var actual []telegraf.Metric
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() == "upsd_config" {
+			actual = append(actual, m)
+		}
+	}
+	testutil.RequireMetricsEqual(t, expected, actual, testutil.IgnoreTime())
+
+	// The configuration is only emitted once
+	acc.ClearMetrics()
+	require.NoError(t, plugin.Gather(&acc))
+	require.False(t, acc.HasMeasurement("upsd_config"))
+	require.True(t, acc.HasMeasurement("upsd"))
+}
+
+func TestUpsdInitServers(t *testing.T) {
+	plugin := &Upsd{Servers: []string{"nut.example.com", "10.0.0.1:1234", "[::1]:3493"}}
+	require.NoError(t, plugin.Init())
+	require.Equal(t, []endpoint{
+		{host: "nut.example.com", port: defaultPort, tagged: true},
+		{host: "10.0.0.1", port: 1234, tagged: true},
+		{host: "::1", port: 3493, tagged: true},
+	}, plugin.endpoints)
+
+	plugin = &Upsd{Servers: []string{"10.0.0.1:port"}}
+	require.Error(t, plugin.Init())
+
+	plugin = &Upsd{}
+	require.Error(t, plugin.Init())
+}
+
+func TestUpsdInitServersFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.txt")
+	content := `# NUT servers of the first floor
+nut1.example.com
+  10.0.0.1:1234
+
+# Duplicates of inline servers are ignored
+10.0.0.2:3493
+`
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	plugin := &Upsd{
+		Server:      defaultAddress,
+		Port:        defaultPort,
+		Servers:     []string{"10.0.0.2"},
+		ServersFile: path,
+	}
+	require.NoError(t, plugin.Init())
+	require.Equal(t, []endpoint{
+		{host: "10.0.0.2", port: defaultPort, tagged: true},
+		{host: "nut1.example.com", port: defaultPort, tagged: true},
+		{host: "10.0.0.1", port: 1234, tagged: true},
+	}, plugin.endpoints)
+
+	// The servers of the file replace the default server
+	plugin = &Upsd{Server: defaultAddress, Port: defaultPort, ServersFile: path}
+	require.NoError(t, plugin.Init())
+	require.Len(t, plugin.endpoints, 3)
+	for _, ep := range plugin.endpoints {
+		require.True(t, ep.tagged)
+	}
+
+	plugin = &Upsd{ServersFile: filepath.Join(t.TempDir(), "missing.txt")}
+	require.Error(t, plugin.Init())
+}
+
+// debugLogger records the debug messages
+type debugLogger struct {
+	testutil.Logger
+	messages []string
+}
+
+func (l *debugLogger) Debugf(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func TestUpsdGatherSummary(t *testing.T) {
+	server := newMockServer()
+	server.addUps("fake1", map[string]string{"ups.status": "OL"})
+	server.addUps("fake2", map[string]string{"ups.status": "OL", "outlet.1.status": "on"})
+	addr := server.listen(t)
+
+	logger := &debugLogger{}
+	plugin := &Upsd{
+		Servers: []string{addr.String(), "127.0.0.1:1"},
+		Log:     logger,
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+
+	var summary string
+	for _, msg := range logger.messages {
+		if strings.HasPrefix(msg, "Gather summary: ") {
+			require.Empty(t, summary, "multiple summaries")
+			summary = msg
+		}
+	}
+	require.NotEmpty(t, summary)
+
+	values := make(map[string]string)
+	for _, pair := range strings.Fields(strings.TrimPrefix(summary, "Gather summary: ")) {
+		parts := strings.SplitN(pair, "=", 2)
+		require.Len(t, parts, 2, pair)
+		values[parts[0]] = parts[1]
+	}
+	require.Equal(t, "2", values["servers"])
+	require.Equal(t, "1", values["reachable"])
+	require.Equal(t, "2", values["ups"])
+	require.Equal(t, strconv.Itoa(len(acc.GetTelegrafMetrics())), values["metrics"])
+	duration, err := time.ParseDuration(values["duration"])
+	require.NoError(t, err)
+	require.Greater(t, duration, time.Duration(0))
+}
+
+func TestUpsdGatherConnectionError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().(*net.TCPAddr)
+	require.NoError(t, ln.Close())
+
+	plugin := &Upsd{
+		Server: addr.IP.String(),
+		Port:   addr.Port,
+		Log:    testutil.Logger{},
+	}
+
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(plugin.Gather))
+	require.False(t, acc.HasMeasurement("upsd"))
+}
+
+func TestUpsdTraceProtocol(t *testing.T) {
+	server := newMockServer()
+	server.password = "secret"
+	server.addUps("fake", map[string]string{"ups.status": "OL"})
+	addr := server.listen(t)
+
+	logger := &debugLogger{}
+	plugin := &Upsd{
+		Server:        addr.IP.String(),
+		Port:          addr.Port,
+		Username:      "user",
+		Password:      "secret",
+		TraceProtocol: true,
+		Log:           logger,
+	}
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Gather(&acc))
+	require.NoError(t, acc.FirstError())
+
+	prefix := addr.String() + " "
+	var trace []string
+	for _, msg := range logger.messages {
+		if strings.HasPrefix(msg, prefix) {
+			trace = append(trace, strings.TrimPrefix(msg, prefix))
+		}
+		require.NotContains(t, msg, "secret")
+	}
+	require.Equal(t, []string{
+		"> USERNAME user",
+		"< OK",
+		"> PASSWORD <redacted>",
+		"< OK",
+		"> LIST UPS",
+		"< BEGIN LIST UPS",
+		`< UPS fake "Description of fake"`,
+		"< END LIST UPS",
+		"> LIST VAR fake",
+		"< BEGIN LIST VAR fake",
+		`< VAR fake ups.status "OL"`,
+		"< END LIST VAR fake",
+		"> LOGOUT",
+		"< OK Goodbye",
+	}, trace)
+
+	// Tracing is off by default
+	logger.messages = nil
+	plugin.TraceProtocol = false
+	require.NoError(t, plugin.Gather(&acc))
+	for _, msg := range logger.messages {
+		require.False(t, strings.HasPrefix(msg, prefix), msg)
+	}
+}
+
+func TestSplitFields(t *testing.T) {
+	require.Equal(t, []string{"VAR", "fake", "ups.mfr", `American "Power"`},
+		splitFields(`VAR fake ups.mfr "American \"Power\""`))
+	require.Equal(t, []string{"UPS", "fake", ""}, splitFields(`UPS fake ""`))
+}
+
+func TestUpsdTagNutUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   *Upsd
+		ep       endpoint
+		expected string
+	}{
+		{
+			name:     "configured credentials",
+			plugin:   &Upsd{Username: "monitor", Password: "secret", TagNutUser: true},
+			expected: "monitor",
+		},
+		{
+			name:     "endpoint credentials",
+			plugin:   &Upsd{Username: "monitor", Password: "secret", TagNutUser: true},
+			ep:       endpoint{auth: authPassword, username: "audit", password: "secret"},
+			expected: "audit",
+		},
+		{
+			name:   "anonymous",
+			plugin: &Upsd{TagNutUser: true},
+		},
+		{
+			name:   "anonymous endpoint",
+			plugin: &Upsd{Username: "monitor", Password: "secret", TagNutUser: true},
+			ep:     endpoint{auth: authNone},
+		},
+		{
+			name:   "disabled",
+			plugin: &Upsd{Username: "monitor", Password: "secret"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.plugin.Log = testutil.Logger{}
+
+			var acc testutil.Accumulator
+			tt.plugin.gatherUps(&acc, tt.ep, "fake", map[string]string{"ups.status": "OL"})
+			require.NoError(t, acc.FirstError())
+			require.Equal(t, tt.expected, acc.TagValue("upsd", "nut_user"))
+			for _, m := range acc.GetTelegrafMetrics() {
+				for _, tag := range m.TagList() {
+					require.NotContains(t, tag.Value, "secret")
+				}
+			}
+		})
+	}
+}
+
+func TestUpsdTagAgentHost(t *testing.T) {
+	hostname = func() (string, error) { return "agent01", nil }
+	defer func() { hostname = os.Hostname }()
+
+	server := newMockServer()
+	server.addUps("fake", map[string]string{"ups.status": "OL", "outlet.1.status": "on"})
+	addr := server.listen(t)
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		host     string
+		expected string
+	}{
+		{name: "disabled"},
+		{name: "os hostname", enabled: true, expected: "agent01"},
+		{name: "configured hostname", enabled: true, host: "container-host", expected: "container-host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &Upsd{
+				Server:       addr.IP.String(),
+				Port:         addr.Port,
+				TagAgentHost: tt.enabled,
+				AgentHost:    tt.host,
+				Log:          testutil.Logger{},
+			}
+			require.NoError(t, plugin.Init())
+
+			var acc testutil.Accumulator
+			require.NoError(t, plugin.Gather(&acc))
+			require.NoError(t, acc.FirstError())
+			require.Len(t, acc.GetTelegrafMetrics(), 4)
+			for _, m := range acc.GetTelegrafMetrics() {
+				value, ok := m.GetTag("agent_host")
+				require.Equal(t, tt.enabled, ok, m.Name())
+				require.Equal(t, tt.expected, value, m.Name())
+			}
+		})
+	}
+}